@@ -1,3 +1,5 @@
 module mysort
 
 go 1.24.2
+
+require golang.org/x/text v0.30.0
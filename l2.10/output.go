@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// outputFile - вывод результата для -o. Результат пишется во временный файл
+// рядом с name и переименовывается в name только после успешной сортировки,
+// поэтому выходной файл может быть одновременно и входным.
+// Без -o вывод идет в STDOUT.
+type outputFile struct {
+	io.Writer
+	name string
+	tmp  *os.File
+}
+
+// createOutput создает вывод в файл name, при пустом name - в STDOUT
+func createOutput(name string) (*outputFile, error) {
+	if name == "" {
+		return &outputFile{Writer: os.Stdout}, nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".sort-*")
+	if err != nil {
+		return nil, fmt.Errorf("cannot create output file: %w", err)
+	}
+	// сохраняем права существующего файла
+	if info, err := os.Stat(name); err == nil {
+		tmp.Chmod(info.Mode().Perm())
+	} else {
+		tmp.Chmod(0o644)
+	}
+
+	return &outputFile{Writer: tmp, name: name, tmp: tmp}, nil
+}
+
+// commit закрывает временный файл и заменяет им выходной
+func (o *outputFile) commit() error {
+	if o.tmp == nil {
+		return nil
+	}
+	if err := o.tmp.Close(); err != nil {
+		os.Remove(o.tmp.Name())
+		return fmt.Errorf("cannot close output file: %w", err)
+	}
+	if err := os.Rename(o.tmp.Name(), o.name); err != nil {
+		os.Remove(o.tmp.Name())
+		return fmt.Errorf("cannot write output file: %w", err)
+	}
+	o.tmp = nil
+	return nil
+}
+
+// abort удаляет временный файл, оставляя выходной без изменений
+func (o *outputFile) abort() {
+	if o.tmp == nil {
+		return
+	}
+	o.tmp.Close()
+	os.Remove(o.tmp.Name())
+	o.tmp = nil
+}
@@ -1,196 +1,291 @@
 package main
 
 import (
-	"bufio"
+	"encoding/binary"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"math/rand/v2"
 	"os"
-	"sort"
 	"strconv"
 	"strings"
-)
 
-// monthMap используется для сортировки по месяцам (-M)
-var monthMap = map[string]int{
-	"Jan": 1, "Feb": 2, "Mar": 3, "Apr": 4,
-	"May": 5, "Jun": 6, "Jul": 7, "Aug": 8,
-	"Sep": 9, "Oct": 10, "Nov": 11, "Dec": 12,
-}
+	"mysort/sortutil"
+)
 
 var (
-	colFlag   = flag.Int("k", 0, "sort by column N (1-based, default: whole line)")
-	numFlag   = flag.Bool("n", false, "compare by numeric value")
-	reverse   = flag.Bool("r", false, "reverse the result")
-	unique    = flag.Bool("u", false, "output only unique lines")
-	monthFlag = flag.Bool("M", false, "compare by month name")
-	ignoreBl  = flag.Bool("b", false, "ignore trailing blanks")
-	check     = flag.Bool("c", false, "check if input is sorted")
-	human     = flag.Bool("h", false, "compare human-readable numbers (1K 2M ...)")
+	numFlag    = flag.Bool("n", false, "compare by numeric value")
+	general    = flag.Bool("g", false, "compare by general numeric value (1e3, inf, NaN)")
+	versionFl  = flag.Bool("V", false, "natural sort of version numbers within text")
+	reverse    = flag.Bool("r", false, "reverse the result")
+	unique     = flag.Bool("u", false, "output only the first of an equal-key run")
+	countFl    = flag.Bool("count", false, "like -u, but prefix each line with the size of its equal-key run")
+	monthFlag  = flag.Bool("M", false, "compare by month name (jan < ... < dec), unknown names first")
+	monthLoc   = flag.String("month-locale", "", "comma-separated month name languages for -M (en, ru); all by default")
+	ignoreBl   = flag.Bool("b", false, "ignore trailing blanks")
+	foldCase   = flag.Bool("f", false, "fold lower case to upper case characters")
+	dictionary = flag.Bool("d", false, "consider only blanks and alphanumeric characters")
+	locale     = flag.String("locale", "", "compare strings using Unicode collation for LOCALE (e.g. ru, en)")
+	check      = flag.Bool("c", false, "check if input is sorted, report the first disorder")
+	checkQuiet = flag.Bool("C", false, "like -c, but do not report the first disorder")
+	merge      = flag.Bool("m", false, "merge already sorted files; do not sort")
+	outFile    = flag.String("o", "", "write result to FILE instead of standard output")
+	stable     = flag.Bool("s", false, "stabilize sort by disabling last-resort comparison")
+	human      = flag.Bool("h", false, "compare human-readable numbers (2K 1.5Gi 10MB ...)")
+	random     = flag.Bool("R", false, "shuffle, but group identical keys; sort by a hash of the key")
+	seed       = flag.String("seed", "", "use unsigned integer N as the seed for -R to make the order reproducible")
+	randomSrc  = flag.String("random-source", "", "get the seed for -R from the first 8 bytes of FILE")
+	fieldSep   = flag.String("t", "", "use SEP instead of non-blank to blank transition as field separator")
+	bufSize    = flag.String("S", "", "use SIZE for main memory buffer, spill sorted runs to disk when exceeded (e.g. 512K, 100M)")
+	parallel   = flag.Int("parallel", 1, "change the number of sorts run concurrently to N")
+	tempDir    = flag.String("T", "", "use DIR for temporary files instead of $TMPDIR")
+	batchSize  = flag.Int("batch-size", sortutil.DefaultBatchSize, "merge at most N inputs at once; for more use temporary files")
+	zeroTerm   = flag.Bool("z", false, "line delimiter is NUL, not newline")
+	format     = flag.String("format", "text", "input format: text, csv or jsonl; with csv and jsonl -k selects a column or a JSON path")
+	header     = flag.Bool("header", false, "treat the first record of each input as a header and output it first")
+	debug      = flag.Bool("debug", false, "annotate the part of the line used to sort, and warn about questionable usage to stderr")
+	maxLine    = flag.Int("max-line-size", 0, "fail on lines longer than N bytes; 0 means no limit")
 )
 
-func readLines(lines []string) []string {
-	if len(flag.Args()) > 0 {
-		for _, fname := range flag.Args() {
-			f, err := os.Open(fname)
-			if err != nil {
-				fmt.Fprintln(os.Stderr, "cannot open file:", err)
-				os.Exit(1)
-			}
-			scanner := bufio.NewScanner(f)
-			for scanner.Scan() {
-				line := scanner.Text()
-				if *ignoreBl {
-					line = strings.TrimRight(line, " ")
-				}
-				lines = append(lines, line)
-			}
-			errClose := f.Close()
-			if errClose != nil {
-				fmt.Fprintln(os.Stderr, "cannot close file:", errClose)
-				os.Exit(1)
-			}
-		}
-	} else {
-		// Иначе читаем из STDIN
-		scanner := bufio.NewScanner(os.Stdin)
-		for scanner.Scan() {
-			line := scanner.Text()
-			if *ignoreBl {
-				line = strings.TrimRight(line, " ")
-			}
-			lines = append(lines, line)
-		}
-	}
+// keys - ключи сортировки (-k), сравниваются по порядку
+var keys keyList
+
+func init() {
+	flag.Var(&keys, "k", "sort via a key; KEYDEF is F[.C][OPTS][,F[.C][OPTS]], OPTS are n, g, V, R, r, M, h, b, f, d (may be repeated); "+
+		"with --format=csv a column number or NAME[:OPTS], with --format=jsonl .PATH[:OPTS]")
+}
+
+// keyList - значения флага -k, который можно указать несколько раз.
+// Ключи разбираются после всех флагов, так как их синтаксис зависит от --format.
+type keyList []string
 
-	return lines
+func (l *keyList) String() string {
+	return fmt.Sprint(*l)
 }
 
-// extractKey извлекает значение из строки для сортировки
-func extractKey(line string, col int) string {
-	if col <= 0 {
-		return line
+func (l *keyList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// options собирает параметры сортировки из флагов
+func options() (sortutil.Options, error) {
+	if *parallel < 1 {
+		return sortutil.Options{}, fmt.Errorf("invalid number of parallel sorts: %d", *parallel)
+	}
+	if *batchSize < 2 {
+		return sortutil.Options{}, fmt.Errorf("invalid --batch-size argument %d: minimum is 2", *batchSize)
 	}
-	parts := strings.Split(line, "\t")
-	if col-1 < len(parts) {
-		return parts[col-1]
+	if *maxLine < 0 {
+		return sortutil.Options{}, fmt.Errorf("invalid max line size: %d", *maxLine)
+	}
+
+	limit, err := sortutil.ParseBufferSize(*bufSize)
+	if err != nil {
+		return sortutil.Options{}, err
+	}
+
+	randomSeed, err := randomSeed()
+	if err != nil {
+		return sortutil.Options{}, err
 	}
-	return line
+
+	f, err := sortutil.ParseFormat(*format)
+	if err != nil {
+		return sortutil.Options{}, err
+	}
+	var monthLocales []string
+	if *monthLoc != "" {
+		monthLocales = strings.Split(*monthLoc, ",")
+	}
+
+	var sortKeys []sortutil.Key
+	for _, spec := range keys {
+		k, err := sortutil.ParseFormatKey(spec, f)
+		if err != nil {
+			return sortutil.Options{}, err
+		}
+		sortKeys = append(sortKeys, k)
+	}
+
+	return sortutil.Options{
+		KeyOptions: sortutil.KeyOptions{
+			Numeric:    *numFlag,
+			General:    *general,
+			Version:    *versionFl,
+			Month:      *monthFlag,
+			Human:      *human,
+			Random:     *random,
+			Reverse:    *reverse,
+			FoldCase:   *foldCase,
+			Dictionary: *dictionary,
+		},
+		Keys:               sortKeys,
+		Separator:          *fieldSep,
+		Format:             f,
+		Header:             *header,
+		Stable:             *stable,
+		Unique:             *unique,
+		Count:              *countFl,
+		TrimTrailingBlanks: *ignoreBl,
+		Locale:             *locale,
+		Debug:              *debug,
+		Warn:               func(msg string) { fmt.Fprintln(os.Stderr, "sort:", msg) },
+		MonthLocales:       monthLocales,
+		RandomSeed:         randomSeed,
+		ZeroTerminated:     *zeroTerm,
+		MaxLineSize:        *maxLine,
+		BufferSize:         limit,
+		TempDir:            *tempDir,
+		Parallel:           *parallel,
+		BatchSize:          *batchSize,
+	}, nil
 }
 
-// parseHuman читает строку вида "10K", "2M"
-func parseHuman(s string) float64 {
-	mult := 1.0
-	if len(s) == 0 {
-		return 0
-	}
-	last := s[len(s)-1]
-	num := s
-	switch last {
-	case 'K', 'k':
-		mult = 1024
-		num = s[:len(s)-1]
-	case 'M', 'm':
-		mult = 1024 * 1024
-		num = s[:len(s)-1]
-	case 'G', 'g':
-		mult = 1024 * 1024 * 1024
-		num = s[:len(s)-1]
-	}
-	v, _ := strconv.ParseFloat(num, 64)
-	return v * mult
+// randomSeed возвращает зерно для -R из --seed или --random-source,
+// без них - случайное, поэтому каждый запуск дает новый порядок
+func randomSeed() (uint64, error) {
+	switch {
+	case *seed != "" && *randomSrc != "":
+		return 0, errors.New("options --seed and --random-source are incompatible")
+	case *seed != "":
+		n, err := strconv.ParseUint(*seed, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid seed: %q", *seed)
+		}
+		return n, nil
+	case *randomSrc != "":
+		f, err := os.Open(*randomSrc)
+		if err != nil {
+			return 0, fmt.Errorf("cannot open random source: %w", err)
+		}
+		defer f.Close()
+
+		var buf [8]byte
+		if _, err := io.ReadFull(f, buf[:]); err != nil {
+			return 0, fmt.Errorf("cannot read random source %s: %w", *randomSrc, err)
+		}
+		return binary.LittleEndian.Uint64(buf[:]), nil
+	}
+	return rand.Uint64(), nil
 }
 
-func lessSort(lines []string) func(i, j int) bool {
-	return func(i, j int) bool {
-		a := extractKey(lines[i], *colFlag)
-		b := extractKey(lines[j], *colFlag)
-
-		var less bool
-
-		if *numFlag {
-			// сортировка чисел
-			af, _ := strconv.ParseFloat(a, 64)
-			bf, _ := strconv.ParseFloat(b, 64)
-			if af != bf {
-				less = af < bf
-			} else {
-				less = a < b // если полученные значения равны, сравниваем строки (например, 1.0 == 1.00)
-			}
-		} else if *monthFlag {
-			// сортировка по месяцу
-			am, aok := monthMap[a]
-			bm, bok := monthMap[b]
-			if aok && bok && am != bm {
-				less = am < bm
-			} else {
-				less = a < b // если месяц не опознан или равен
-			}
-		} else if *human {
-			// человекочитаемые размеры
-			af := parseHuman(a)
-			bf := parseHuman(b)
-			if af != bf {
-				less = af < bf
-			} else {
-				less = a < b // если полученные значения равны, сравниваем строки (например, 1K == 1024)
-			}
-		} else {
-			// сравнение строк
-			less = a < b
+// openInputs открывает файлы из аргументов, без аргументов - STDIN
+func openInputs() ([]io.Reader, func(), error) {
+	if len(flag.Args()) == 0 {
+		return []io.Reader{os.Stdin}, func() {}, nil
+	}
+
+	var files []*os.File
+	closeAll := func() {
+		for _, f := range files {
+			f.Close()
 		}
+	}
 
-		if *reverse {
-			return !less
+	readers := make([]io.Reader, 0, len(flag.Args()))
+	for _, fname := range flag.Args() {
+		f, err := os.Open(fname)
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("cannot open file: %w", err)
 		}
-		return less
+		files = append(files, f)
+		readers = append(readers, f)
 	}
+	return readers, closeAll, nil
 }
 
-// checkSorted проверяет, отсортированы ли передаваемые значения
-func checkSorted(lines []string) error {
-	less := lessSort(lines)
-	for i := 1; i < len(lines); i++ {
-		// если порядок нарушен (строка i < предыдущей)
-		if less(i, i-1) {
-			// выводим первую "неправильную" строку
-			return fmt.Errorf("sort: not sorted: %s", lines[i])
+// checkFiles построчно проверяет порядок в каждом входном файле (или STDIN)
+func checkFiles(opts sortutil.Options) error {
+	if len(flag.Args()) == 0 {
+		return sortutil.Check(os.Stdin, "-", opts)
+	}
+
+	for _, fname := range flag.Args() {
+		f, err := os.Open(fname)
+		if err != nil {
+			return fmt.Errorf("cannot open file: %w", err)
+		}
+		err = sortutil.Check(f, fname, opts)
+		f.Close()
+		if err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-func main() {
-	flag.Parse()
+// sortFiles сортирует (или с -m сливает) входные файлы в w
+func sortFiles(w io.Writer, opts sortutil.Options) error {
+	// при слиянии файлы открываются группами, не больше --batch-size сразу
+	if *merge {
+		names := flag.Args()
+		if len(names) == 0 {
+			names = []string{"-"}
+		}
+		return sortutil.MergeFiles(names, w, opts)
+	}
 
-	var lines []string
-	lines = readLines(lines)
+	inputs, closeInputs, err := openInputs()
+	if err != nil {
+		return err
+	}
+	defer closeInputs()
 
-	if *check {
-		err := checkSorted(lines)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
-		} else {
-			os.Exit(0)
+	sorter, err := sortutil.NewSorter(opts)
+	if err != nil {
+		return err
+	}
+	defer sorter.Close()
+
+	for _, r := range inputs {
+		if err := sorter.AddFrom(r); err != nil {
+			return err
 		}
-	} else {
-		sort.Slice(lines, lessSort(lines))
-	}
-
-	// unique
-	if *unique {
-		var uniq []string
-		var prev string
-		for _, l := range lines {
-			if l != prev {
-				uniq = append(uniq, l)
-				prev = l
-			}
+	}
+	return sorter.WriteSorted(w)
+}
+
+// run выполняет сортировку, проверку или слияние в соответствии с флагами
+func run() error {
+	opts, err := options()
+	if err != nil {
+		return err
+	}
+
+	if *check || *checkQuiet {
+		return checkFiles(opts)
+	}
+
+	if *debug {
+		for _, w := range sortutil.Warnings(opts) {
+			fmt.Fprintln(os.Stderr, "sort:", w)
 		}
-		lines = uniq
 	}
 
-	for _, l := range lines {
-		fmt.Println(l)
+	out, err := createOutput(*outFile)
+	if err != nil {
+		return err
+	}
+	defer out.abort()
+
+	if err := sortFiles(out, opts); err != nil {
+		return err
+	}
+	return out.commit()
+}
+
+func main() {
+	flag.Parse()
+
+	if err := run(); err != nil {
+		// -C сообщает о нарушении порядка только кодом возврата
+		var disorder *sortutil.DisorderError
+		if !*checkQuiet || !errors.As(err, &disorder) {
+			fmt.Fprintln(os.Stderr, "sort:", err)
+		}
+		os.Exit(1)
 	}
 }
@@ -1,307 +1,159 @@
 package main
 
 import (
-	"sort"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
 	"testing"
-)
-
-func resetFlags() {
-	*numFlag = false
-	*reverse = false
-	*unique = false
-	*monthFlag = false
-	*ignoreBl = false
-	*check = false
-	*human = false
-	*colFlag = 0
-}
 
-// TestExtractKey проверяет функцию extractKey
-func TestExtractKey(t *testing.T) {
-	line := "foo\tbar\tbaz"
+	"mysort/sortutil"
+)
 
-	tests := []struct {
-		col  int
-		want string
-	}{
-		{0, line},  // без указания колонки
-		{1, "foo"}, // первая колонка
-		{2, "bar"}, // вторая колонка
-		{3, "baz"}, // третья колонка
-		{4, line},  // колонки нет
-		{-1, line}, // невалидный col
+// TestOptionsFromFlags проверяет сборку sortutil.Options из флагов командной строки
+func TestOptionsFromFlags(t *testing.T) {
+	keys = nil
+	t.Cleanup(func() {
+		keys = nil
+		*numFlag, *reverse, *fieldSep, *bufSize = false, false, "", ""
+	})
+	if err := flag.CommandLine.Parse([]string{"-n", "-r", "-t", ",", "-k", "2,2", "-S", "1K"}); err != nil {
+		t.Fatal(err)
 	}
 
-	for _, tt := range tests {
-		got := extractKey(line, tt.col)
-		if got != tt.want {
-			t.Errorf("extractKey(%q, %d) = %q, want %q", line, tt.col, got, tt.want)
-		}
+	opts, err := options()
+	if err != nil {
+		t.Fatalf("options: %v", err)
 	}
-}
-
-// TestParseHuman проверяет функцию parseHuman
-func TestParseHuman(t *testing.T) {
-	tests := []struct {
-		in   string
-		want float64
-	}{
-		{"", 0},
-		{"10", 10},
-		{"1K", 1024},
-		{"2M", 2 * 1024 * 1024},
-		{"3G", 3 * 1024 * 1024 * 1024},
-		{"5k", 5 * 1024},
-		{"7m", 7 * 1024 * 1024},
+	if !opts.Numeric || !opts.Reverse || opts.Separator != "," || opts.BufferSize != 1024 {
+		t.Errorf("unexpected options: %+v", opts)
 	}
-
-	for _, tt := range tests {
-		got := parseHuman(tt.in)
-		if got != tt.want {
-			t.Errorf("parseHuman(%q) = %v, want %v", tt.in, got, tt.want)
-		}
+	if len(opts.Keys) != 1 || opts.Keys[0].StartField != 2 || opts.Keys[0].EndField != 2 {
+		t.Errorf("unexpected keys: %+v", opts.Keys)
 	}
 }
 
-// TestLessSortNumeric проверяет функцию lessSort с флагом -n
-func TestLessSortNumeric(t *testing.T) {
-	resetFlags()
-	*numFlag = true
-
-	lines := []string{"10", "2", "30"}
-
-	sort.Slice(lines, lessSort(lines))
+// TestRandomSeed проверяет зерно -R из --seed и --random-source
+func TestRandomSeed(t *testing.T) {
+	t.Cleanup(func() { *seed, *randomSrc = "", "" })
 
-	want := []string{"2", "10", "30"}
-	for i := range want {
-		if lines[i] != want[i] {
-			t.Errorf("numeric sort mismatch: got %v, want %v", lines, want)
-			break
-		}
+	*seed = "12345"
+	if got, err := randomSeed(); err != nil || got != 12345 {
+		t.Errorf("randomSeed() with --seed = %d, %v, want 12345", got, err)
 	}
-}
-
-// TestLessSortReverse проверяет функцию lessSort с флагом -r
-func TestLessSortReverse(t *testing.T) {
-	resetFlags()
-	*reverse = true
 
-	lines := []string{"a", "c", "b"}
-
-	sort.Slice(lines, lessSort(lines))
-
-	want := []string{"c", "b", "a"}
-	for i := range want {
-		if lines[i] != want[i] {
-			t.Errorf("reverse sort mismatch: got %v, want %v", lines, want)
-			break
-		}
+	*seed = "abc"
+	if _, err := randomSeed(); err == nil {
+		t.Error("expected error for invalid --seed")
 	}
-}
-
-// TestLessSortReverse проверяет функцию lessSort с флагом -M
-func TestLessSortMonth(t *testing.T) {
-	resetFlags()
-	*monthFlag = true
-
-	// последнее значение ("Feb ") с дополнительным пробелом, должно идти после значения без пробела
-	lines := []string{"Mar", "Feb", "Jan", "Feb "}
 
-	sort.Slice(lines, lessSort(lines))
-
-	want := []string{"Jan", "Feb", "Feb ", "Mar"}
-	for i := range want {
-		if lines[i] != want[i] {
-			t.Errorf("month sort mismatch: got %v, want %v", lines, want)
-			break
-		}
+	*seed = ""
+	src := filepath.Join(t.TempDir(), "random")
+	os.WriteFile(src, []byte{1, 0, 0, 0, 0, 0, 0, 0, 0xff}, 0o644)
+	*randomSrc = src
+	if got, err := randomSeed(); err != nil || got != 1 {
+		t.Errorf("randomSeed() with --random-source = %d, %v, want 1", got, err)
 	}
-}
-
-// TestLessSortReverse проверяет функцию lessSort с флагом -h
-func TestLessSortHuman(t *testing.T) {
-	resetFlags()
-	*human = true
-
-	lines := []string{"2K", "1M", "2048", "512"}
-
-	sort.Slice(lines, lessSort(lines))
 
-	want := []string{"512", "2048", "2K", "1M"}
-
-	for i := range want {
-		if lines[i] != want[i] {
-			t.Errorf("human sort mismatch: got %v, want %v", lines, want)
-			break
-		}
+	os.WriteFile(src, []byte{1, 2}, 0o644)
+	if _, err := randomSeed(); err == nil {
+		t.Error("expected error for short --random-source")
 	}
-}
 
-// TestCheckSorted_StringSorted проверяет отсортированные строки с флагом -c
-func TestCheckSorted_StringSorted(t *testing.T) {
-	resetFlags()
-	lines := []string{"a", "b", "c"}
-	if err := checkSorted(lines); err != nil {
-		t.Errorf("expected sorted, got error %v", err)
+	*seed = "1"
+	if _, err := randomSeed(); err == nil {
+		t.Error("expected error for --seed with --random-source")
 	}
 }
 
-// TestCheckSorted_StringSorted проверяет НЕ отсортированные строки с флагом -c
-func TestCheckSorted_StringUnsorted(t *testing.T) {
-	resetFlags()
-	lines := []string{"b", "a"}
-	if err := checkSorted(lines); err == nil {
-		t.Errorf("expected error for unsorted input")
+// TestOutputFileSameAsInput проверяет, что -o заменяет файл только после commit
+func TestOutputFileSameAsInput(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "data.txt")
+	if err := os.WriteFile(name, []byte("b\na\n"), 0o600); err != nil {
+		t.Fatal(err)
 	}
-}
 
-// TestCheckSorted_StringSorted проверяет отсортированные строки с флагом -cn
-func TestCheckSorted_Numeric(t *testing.T) {
-	resetFlags()
-	*numFlag = true
-	lines := []string{"1", "2", "10"}
-	if err := checkSorted(lines); err != nil {
-		t.Errorf("expected sorted numbers, got error %v", err)
+	out, err := createOutput(name)
+	if err != nil {
+		t.Fatalf("createOutput: %v", err)
 	}
-}
+	io.WriteString(out, "a\nb\n")
 
-// TestCheckSorted_StringSorted проверяет НЕ отсортированные строки с флагом -cn
-func TestCheckSorted_NumericUnsorted(t *testing.T) {
-	resetFlags()
-	*numFlag = true
-	lines := []string{"10", "2", "1"}
-	if err := checkSorted(lines); err == nil {
-		t.Errorf("expected error for unsorted numeric input")
+	// до commit исходный файл не изменен
+	if data, _ := os.ReadFile(name); string(data) != "b\na\n" {
+		t.Errorf("input changed before commit: %q", data)
 	}
-}
 
-// TestCheckSorted_StringSorted проверяет отсортированные строки с флагом -cM
-func TestCheckSorted_Months(t *testing.T) {
-	resetFlags()
-	*monthFlag = true
-	lines := []string{"Jan", "Feb", "Mar"}
-	if err := checkSorted(lines); err != nil {
-		t.Errorf("expected sorted months, got error %v", err)
+	if err := out.commit(); err != nil {
+		t.Fatalf("commit: %v", err)
 	}
-}
+	out.abort()
 
-// TestCheckSorted_StringSorted проверяет НЕ отсортированные строки с флагом -cM
-func TestCheckSorted_MonthsUnsorted(t *testing.T) {
-	resetFlags()
-	*monthFlag = true
-	lines := []string{"Mar", "Jan"}
-	if err := checkSorted(lines); err == nil {
-		t.Errorf("expected error for unsorted months")
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
 	}
-}
-
-// TestCheckSorted_StringSorted проверяет отсортированные строки с флагом -ch
-func TestCheckSorted_HumanReadable(t *testing.T) {
-	resetFlags()
-	*human = true
-	lines := []string{"1K", "2K", "10M"}
-	if err := checkSorted(lines); err != nil {
-		t.Errorf("expected sorted human-readable, got error %v", err)
+	if string(data) != "a\nb\n" {
+		t.Errorf("output mismatch: got %q", data)
 	}
-}
 
-// TestCheckSorted_StringSorted проверяет НЕ отсортированные строки с флагом -ch
-func TestCheckSorted_HumanReadableUnsorted(t *testing.T) {
-	resetFlags()
-	*human = true
-	lines := []string{"10M", "2K"}
-	if err := checkSorted(lines); err == nil {
-		t.Errorf("expected error for unsorted human-readable numbers")
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("output mode = %v, want %v", info.Mode().Perm(), os.FileMode(0o600))
 	}
-}
 
-// TestCheckSorted_StringSorted проверяет НЕ отсортированные строки с флагом -cr
-func TestCheckSorted_Reverse(t *testing.T) {
-	resetFlags()
-	*reverse = true
-	lines := []string{"c", "b", "a"}
-	if err := checkSorted(lines); err != nil {
-		t.Errorf("expected sorted in reverse, got error %v", err)
+	entries, _ := os.ReadDir(filepath.Dir(name))
+	if len(entries) != 1 {
+		t.Errorf("expected only output file in dir, got %d entries", len(entries))
 	}
 }
 
-// TestSortByColumn проверяет сортировку по колонке с флагом -k 1
-func TestSortByColumn(t *testing.T) {
-	resetFlags()
-	lines := []string{
-		"3\tapple",
-		"1\tpear",
-		"2\tbanana",
+// TestOutputFileAbort проверяет, что при ошибке выходной файл не меняется
+func TestOutputFileAbort(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "data.txt")
+	if err := os.WriteFile(name, []byte("old\n"), 0o644); err != nil {
+		t.Fatal(err)
 	}
 
-	*colFlag = 1
-	*numFlag = true
-	sort.Slice(lines, lessSort(lines))
-
-	want := []string{
-		"1\tpear",
-		"2\tbanana",
-		"3\tapple",
+	out, err := createOutput(name)
+	if err != nil {
+		t.Fatalf("createOutput: %v", err)
 	}
+	io.WriteString(out, "new\n")
+	out.abort()
 
-	for i := range want {
-		if lines[i] != want[i] {
-			t.Errorf("sort by col=1 numeric failed: got %v, want %v", lines, want)
-			break
-		}
+	if data, _ := os.ReadFile(name); string(data) != "old\n" {
+		t.Errorf("output changed after abort: %q", data)
 	}
-}
-
-// TestSortByColumn проверяет сортировку по колонке с флагом -k 2
-func TestSortBySecondColumn(t *testing.T) {
-	resetFlags()
-	lines := []string{
-		"1\tpear",
-		"2\tbanana",
-		"3\tapple",
+	entries, _ := os.ReadDir(filepath.Dir(name))
+	if len(entries) != 1 {
+		t.Errorf("expected temp file to be removed, got %d entries", len(entries))
 	}
+}
 
-	*colFlag = 2
-	*numFlag = false
-	sort.Slice(lines, lessSort(lines))
-
-	want := []string{
-		"3\tapple",
-		"2\tbanana",
-		"1\tpear",
-	}
+// TestCheckFiles проверяет потоковую проверку файлов с именем файла в сообщении
+func TestCheckFiles(t *testing.T) {
+	dir := t.TempDir()
+	sorted := filepath.Join(dir, "sorted.txt")
+	unsorted := filepath.Join(dir, "unsorted.txt")
+	os.WriteFile(sorted, []byte("1\n2\n3\n"), 0o644)
+	os.WriteFile(unsorted, []byte("1\n3\n2\n"), 0o644)
 
-	for i := range want {
-		if lines[i] != want[i] {
-			t.Errorf("sort by col=2 alpha failed: got %v, want %v", lines, want)
-			break
-		}
+	if err := flag.CommandLine.Parse([]string{sorted}); err != nil {
+		t.Fatal(err)
 	}
-}
-
-// TestSortByColumn проверяет сортировку по колонке с флагом -r -k 1
-func TestSortBySecondColumnReverse(t *testing.T) {
-	resetFlags()
-	lines := []string{
-		"1\tpear",
-		"2\tbanana",
-		"3\tapple",
+	if err := checkFiles(sortutil.Options{}); err != nil {
+		t.Errorf("expected sorted file, got %v", err)
 	}
 
-	*colFlag = 2
-	*reverse = true
-	sort.Slice(lines, lessSort(lines))
-
-	want := []string{
-		"1\tpear",
-		"2\tbanana",
-		"3\tapple",
+	if err := flag.CommandLine.Parse([]string{sorted, unsorted}); err != nil {
+		t.Fatal(err)
 	}
-
-	for i := range want {
-		if lines[i] != want[i] {
-			t.Errorf("sort by col=2 reverse failed: got %v, want %v", lines, want)
-			break
-		}
+	err := checkFiles(sortutil.Options{})
+	if want := unsorted + ":3: disorder: 2"; err == nil || err.Error() != want {
+		t.Errorf("checkFiles(sortutil.Options{}) = %v, want %q", err, want)
 	}
 }
@@ -0,0 +1,72 @@
+package sortutil
+
+import (
+	"fmt"
+	"io"
+)
+
+// DisorderError - первая строка, нарушающая порядок сортировки
+type DisorderError struct {
+	Name string // имя входа
+	Line int    // номер строки, начиная с 1
+	Text string // текст строки
+}
+
+func (e *DisorderError) Error() string {
+	return fmt.Sprintf("%s:%d: disorder: %s", e.Name, e.Line, e.Text)
+}
+
+// sortChecker проверяет порядок строк по мере чтения, храня только предыдущую строку.
+// С Unique равные по ключам соседние строки тоже считаются нарушением порядка.
+type sortChecker struct {
+	name    string
+	cmp     *Comparator
+	unique  bool
+	prev    sortItem
+	hasPrev bool
+	lineNum int
+}
+
+// check проверяет очередную строку относительно предыдущей
+func (c *sortChecker) check(line string) error {
+	c.lineNum++
+	item := c.cmp.decorate(line)
+
+	if c.hasPrev {
+		var disorder bool
+		if c.unique {
+			disorder = c.cmp.compareKeys(&c.prev, &item) >= 0
+		} else {
+			disorder = c.cmp.compare(&c.prev, &item) > 0
+		}
+		if disorder {
+			return &DisorderError{Name: c.name, Line: c.lineNum, Text: line}
+		}
+	}
+
+	c.prev, c.hasPrev = item, true
+	return nil
+}
+
+// Check построчно проверяет, что вход r с именем name отсортирован с параметрами opts.
+// Первое нарушение порядка возвращается как *DisorderError.
+func Check(r io.Reader, name string, opts Options) error {
+	cmp, err := NewComparator(opts)
+	if err != nil {
+		return err
+	}
+
+	c := &sortChecker{name: name, cmp: cmp, unique: opts.Unique || opts.Count}
+	if !opts.Header {
+		return scanLines(r, opts, c.check)
+	}
+
+	// заголовок не участвует в проверке, но учитывается в номерах строк
+	return scanLines(r, opts, func(line string) error {
+		if c.lineNum == 0 {
+			c.lineNum++
+			return cmp.setHeader(line)
+		}
+		return c.check(line)
+	})
+}
@@ -0,0 +1,372 @@
+package sortutil
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// keyValue - ключ строки, разобранный один раз перед сортировкой
+type keyValue struct {
+	raw   string  // извлеченный текст ключа
+	text  string  // текст для сравнения строк с учетом -d и -f
+	coll  []byte  // ключ сортировки Unicode collation для --locale
+	num   float64 // значение для -n, -g и -h
+	class int     // для -g и -h: 0 - не число, 1 - NaN, 2 - число
+	month int     // номер месяца для -M, 0 - не опознан
+	hash  uint64  // хеш ключа для -R
+	kind  int     // тип значения JSON, jsonMissing для текста и CSV
+}
+
+// sortItem - строка вместе с разобранными ключами
+type sortItem struct {
+	line string
+	keys []keyValue
+}
+
+// Comparator сравнивает строки по ключам и модификаторам Options.
+// Compare, Equal и decorate нельзя вызывать из нескольких горутин одновременно:
+// decorate использует общий collBuf. Сравнение уже разобранных строк (compare,
+// compareKeys) только читает Comparator, и на этом держится parallelSort,
+// поэтому compare не должен менять состояние Comparator.
+type Comparator struct {
+	keys       []Key
+	sep        string
+	format     Format
+	comma      rune
+	opts       []KeyOptions
+	stable     bool
+	lastResort bool
+	reverse    bool
+	seed       uint64
+	months     map[string]int
+	collator   *collate.Collator
+	collBuf    collate.Buffer
+}
+
+// NewComparator строит Comparator по параметрам сортировки.
+// Без Keys используется один ключ - вся строка с глобальными модификаторами.
+// С Unique сортировка стабильна и без сравнения строк целиком, чтобы первой
+// в группе равных ключей оставалась строка, встретившаяся раньше.
+func NewComparator(opts Options) (*Comparator, error) {
+	stable := opts.Stable || opts.Unique || opts.Count
+	c := &Comparator{
+		keys:       slices.Clone(opts.Keys),
+		sep:        opts.Separator,
+		format:     opts.Format,
+		comma:      csvComma(opts.Separator),
+		stable:     stable,
+		lastResort: !stable,
+		reverse:    opts.Reverse,
+		seed:       opts.RandomSeed,
+	}
+	if opts.Locale != "" {
+		tag, err := language.Parse(opts.Locale)
+		if err != nil {
+			return nil, fmt.Errorf("invalid locale %q: %w", opts.Locale, err)
+		}
+		c.collator = collate.New(tag)
+	}
+	for _, k := range opts.Keys {
+		switch {
+		case opts.Format == FormatJSONL && k.Name == "":
+			return nil, fmt.Errorf("JSON key must be a path starting with '.'")
+		case opts.Format == FormatCSV && k.Name != "" && !opts.Header:
+			return nil, fmt.Errorf("column name %q requires a header", k.Name)
+		case opts.Format == FormatText && k.Name != "":
+			return nil, fmt.Errorf("named key %q requires --format=csv or jsonl", k.Name)
+		}
+	}
+	months, err := monthTable(opts.MonthLocales)
+	if err != nil {
+		return nil, err
+	}
+	c.months = months
+
+	if len(opts.Keys) == 0 {
+		c.opts = []KeyOptions{opts.KeyOptions}
+	} else {
+		for _, k := range opts.Keys {
+			c.opts = append(c.opts, k.options(opts.KeyOptions))
+		}
+	}
+	return c, nil
+}
+
+// Compare сравнивает строки a и b: отрицательное значение, если a идет раньше b,
+// 0 - если строки равны, положительное - если a идет позже
+func (c *Comparator) Compare(a, b string) int {
+	x, y := c.decorate(a), c.decorate(b)
+	return c.compare(&x, &y)
+}
+
+// Equal проверяет, равны ли ключи строк a и b (например, для Unique)
+func (c *Comparator) Equal(a, b string) bool {
+	x, y := c.decorate(a), c.decorate(b)
+	return c.compareKeys(&x, &y) == 0
+}
+
+// setHeader находит колонки CSV, указанные в ключах по имени, в заголовке header
+func (c *Comparator) setHeader(header string) error {
+	if c.format != FormatCSV {
+		return nil
+	}
+	names := csvFields(header, c.comma)
+	for i, k := range c.keys {
+		if k.Name == "" {
+			continue
+		}
+		col := slices.Index(names, k.Name)
+		if col < 0 {
+			return fmt.Errorf("unknown column %q", k.Name)
+		}
+		c.keys[i].StartField = col + 1
+	}
+	return nil
+}
+
+// decorate разбирает ключи строки
+func (c *Comparator) decorate(line string) sortItem {
+	item := sortItem{line: line, keys: make([]keyValue, len(c.opts))}
+	if len(c.keys) == 0 {
+		item.keys[0] = c.parseKeyValue(line, c.opts[0])
+		return item
+	}
+
+	switch c.format {
+	case FormatCSV:
+		fields := csvFields(line, c.comma)
+		for i, opts := range c.opts {
+			var raw string
+			if col := c.keys[i].StartField; col >= 1 && col <= len(fields) {
+				raw = fields[col-1]
+			}
+			item.keys[i] = c.parseKeyValue(raw, opts)
+		}
+	case FormatJSONL:
+		// строка - не JSON: все ключи отсутствуют и идут первыми
+		doc, ok := parseJSON(line)
+		for i, opts := range c.opts {
+			raw, kind := "", jsonMissing
+			if ok {
+				raw, kind = lookupJSON(doc, c.keys[i].Name)
+			}
+			item.keys[i] = c.parseKeyValue(raw, opts)
+			item.keys[i].kind = kind
+			if kind == jsonNumber {
+				item.keys[i].num, _ = strconv.ParseFloat(raw, 64)
+			}
+		}
+	default:
+		for i, opts := range c.opts {
+			item.keys[i] = c.parseKeyValue(extractKey(line, c.keys[i], c.sep), opts)
+		}
+	}
+	return item
+}
+
+// decorateAll разбирает ключи всех строк
+func (c *Comparator) decorateAll(lines []string) []sortItem {
+	items := make([]sortItem, len(lines))
+	for i, l := range lines {
+		items[i] = c.decorate(l)
+	}
+	return items
+}
+
+// compare сравнивает строки по ключам по порядку: следующий ключ
+// используется, только если предыдущие равны. Если все ключи равны,
+// строки сравниваются целиком побайтно (кроме -s).
+func (c *Comparator) compare(a, b *sortItem) int {
+	if r := c.compareKeys(a, b); r != 0 || !c.lastResort {
+		return r
+	}
+
+	r := strings.Compare(a.line, b.line)
+	if c.reverse {
+		return -r
+	}
+	return r
+}
+
+// compareKeys сравнивает строки только по ключам
+func (c *Comparator) compareKeys(a, b *sortItem) int {
+	for i, opts := range c.opts {
+		if r := compareValues(a.keys[i], b.keys[i], opts); r != 0 {
+			return r
+		}
+	}
+	return 0
+}
+
+// parseKeyValue разбирает значение ключа в соответствии с модификаторами
+func (c *Comparator) parseKeyValue(raw string, opts KeyOptions) keyValue {
+	v := keyValue{raw: raw, text: raw}
+	if opts.Dictionary {
+		v.text = dictionaryText(v.text)
+	}
+
+	if c.collator != nil {
+		// учет регистра при --locale выполняет сам collator
+		if opts.FoldCase {
+			v.text = strings.ToLower(v.text)
+		}
+		v.coll = bytes.Clone(c.collator.KeyFromString(&c.collBuf, v.text))
+		c.collBuf.Reset()
+	} else if opts.FoldCase {
+		v.text = strings.ToUpper(v.text)
+	}
+
+	if opts.Random {
+		v.hash = randomHash(c.seed, v.text)
+	}
+
+	switch {
+	case opts.Numeric:
+		v.num, _, _ = scanNumeric(raw)
+	case opts.General:
+		v.num, v.class = parseGeneral(raw)
+	case opts.Month:
+		v.month = parseMonth(raw, c.months)
+	case opts.Human:
+		var ok bool
+		if v.num, ok = parseHuman(raw); ok {
+			v.class = 2
+		}
+	}
+	return v
+}
+
+// compareValues сравнивает разобранные значения ключей с учетом модификаторов
+func compareValues(a, b keyValue, opts KeyOptions) int {
+	var c int
+
+	if opts.Random {
+		// случайный порядок, при равных хешах - сравнение по остальным модификаторам
+		c = cmp.Compare(a.hash, b.hash)
+	}
+
+	switch {
+	case c != 0:
+	case opts.Numeric:
+		// сортировка чисел, 1.0 и 1.00 равны
+		c = cmp.Compare(a.num, b.num)
+	case opts.General:
+		// не числа < NaN < -inf < числа < +inf
+		c = cmp.Compare(a.class, b.class)
+		if c == 0 && a.class == 2 {
+			c = cmp.Compare(a.num, b.num)
+		}
+	case opts.Month:
+		// сортировка по месяцу, неопознанные значения идут перед январем
+		c = cmp.Compare(a.month, b.month)
+	case opts.Human:
+		// человекочитаемые размеры, 1K и 1024 равны; не числа идут перед числами
+		c = cmp.Compare(a.class, b.class)
+		if c == 0 {
+			c = cmp.Compare(a.num, b.num)
+		}
+	case opts.Version:
+		c = compareVersion(a.raw, b.raw)
+	case a.kind != b.kind:
+		// значения JSON разных типов: нет значения < null < bool < числа < строки < объекты
+		c = cmp.Compare(a.kind, b.kind)
+	case a.kind == jsonNumber:
+		c = cmp.Compare(a.num, b.num)
+	default:
+		// сравнение строк
+		if a.coll != nil {
+			c = bytes.Compare(a.coll, b.coll)
+		}
+		if c == 0 {
+			c = strings.Compare(a.text, b.text)
+		}
+	}
+
+	if opts.Reverse {
+		return -c
+	}
+	return c
+}
+
+// parseGeneral разбирает самый длинный префикс ключа, являющийся числом
+// с плавающей точкой (в том числе 1e3, inf, NaN), и возвращает его класс для -g
+func parseGeneral(s string) (float64, int) {
+	v, class, _ := scanGeneral(s)
+	return v, class
+}
+
+// scanGeneral разбирает самый длинный префикс s, являющийся числом, и возвращает
+// его значение, класс и конец префикса в s (0, если числа нет)
+func scanGeneral(s string) (float64, int, int) {
+	begin := len(s) - len(strings.TrimLeft(s, " \t"))
+	s = s[begin:]
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		s = s[:i]
+	}
+
+	for end := len(s); end > 0; end-- {
+		v, err := strconv.ParseFloat(s[:end], 64)
+		if err != nil {
+			var numErr *strconv.NumError
+			if !errors.As(err, &numErr) || numErr.Err != strconv.ErrRange {
+				continue
+			}
+		}
+		if math.IsNaN(v) {
+			return 0, 1, begin + end
+		}
+		return v, 2, begin + end
+	}
+	return 0, 0, 0
+}
+
+// scanNumeric разбирает число в начале s для -n: пробелы, знак, цифры и дробная часть,
+// текст после числа игнорируется, как в GNU sort. Возвращает значение, конец числа в s
+// и false, если s не начинается с числа (тогда значение 0).
+func scanNumeric(s string) (float64, int, bool) {
+	begin := len(s) - len(strings.TrimLeft(s, " \t"))
+	s = s[begin:]
+
+	end, digits := 0, 0
+	if end < len(s) && (s[end] == '-' || s[end] == '+') {
+		end++
+	}
+	for end < len(s) && isDigit(s[end]) {
+		end++
+		digits++
+	}
+	if end < len(s) && s[end] == '.' {
+		end++
+		for end < len(s) && isDigit(s[end]) {
+			end++
+			digits++
+		}
+	}
+	if digits == 0 {
+		return 0, 0, false
+	}
+
+	// ошибка возможна только при переполнении, тогда v - бесконечность со знаком числа
+	v, _ := strconv.ParseFloat(s[:end], 64)
+	return v, begin + end, true
+}
+
+// dictionaryText оставляет в строке только пробелы, буквы и цифры (-d)
+func dictionaryText(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, s)
+}
@@ -0,0 +1,170 @@
+package sortutil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Warnings возвращает предупреждения о подозрительных параметрах сортировки
+// для --debug, как в GNU sort
+func Warnings(opts Options) []string {
+	var warnings []string
+
+	if opts.Locale != "" {
+		warnings = append(warnings, fmt.Sprintf("text ordering performed using %q sorting rules", opts.Locale))
+	} else {
+		warnings = append(warnings, "text ordering performed using simple byte comparison")
+	}
+
+	allOwn := len(opts.Keys) > 0
+	for i, k := range opts.Keys {
+		ko := k.options(opts.KeyOptions)
+		if !k.HasOptions {
+			allOwn = false
+		}
+		if opts.Format != FormatText {
+			continue
+		}
+
+		numeric := ko.Numeric || ko.General || ko.Human
+		if numeric && (k.EndField == 0 || k.EndField > k.StartField) {
+			warnings = append(warnings, fmt.Sprintf("key %d is numeric and spans multiple fields", i+1))
+		}
+		if !numeric && !ko.Month && !ko.IgnoreBlanks && opts.Separator == "" && (k.StartField > 1 || k.StartChar > 1) {
+			warnings = append(warnings, fmt.Sprintf("leading blanks are significant in key %d; consider also specifying 'b'", i+1))
+		}
+	}
+
+	// глобальные модификаторы не применяются к ключам с собственными модификаторами
+	if allOwn {
+		g := opts.KeyOptions
+		var ignored string
+		for _, o := range []struct {
+			set  bool
+			name byte
+		}{
+			{g.IgnoreBlanks, 'b'}, {g.Dictionary, 'd'}, {g.FoldCase, 'f'}, {g.General, 'g'}, {g.Human, 'h'},
+			{g.Month, 'M'}, {g.Numeric, 'n'}, {g.Random, 'R'}, {g.Version, 'V'},
+		} {
+			if o.set {
+				ignored += string(o.name)
+			}
+		}
+		switch {
+		case len(ignored) == 1:
+			warnings = append(warnings, fmt.Sprintf("option '-%s' is ignored", ignored))
+		case len(ignored) > 1:
+			warnings = append(warnings, fmt.Sprintf("options '-%s' are ignored", ignored))
+		}
+		if g.Reverse && !opts.Stable && !opts.Unique && !opts.Count {
+			warnings = append(warnings, "option '-r' only applies to last-resort comparison")
+		}
+	}
+
+	return warnings
+}
+
+// annotate возвращает строки --debug для строки line: под каждым ключом
+// подчеркивания на месте использованной части ключа, в конце - подчеркивание
+// всей строки, если она сравнивается целиком. Табы в line выводятся как '>'.
+// Для числовых ключей (n, g, h) без числа вызывается noValue с номером ключа от 0.
+func (c *Comparator) annotate(line string, noValue func(key int)) []string {
+	var notes []string
+
+	if c.format != FormatText && len(c.keys) > 0 {
+		item := c.decorate(line)
+		for i, k := range c.keys {
+			name := k.Name
+			if name == "" {
+				name = "column " + strconv.Itoa(k.StartField)
+			}
+			v := item.keys[i]
+			if v.raw == "" && v.kind <= jsonNull {
+				notes = append(notes, fmt.Sprintf("^ no match for key %s", name))
+			} else {
+				notes = append(notes, fmt.Sprintf("^ key %s: %q", name, v.raw))
+			}
+		}
+	} else {
+		for i, opts := range c.opts {
+			start, end := 0, len(line)
+			if len(c.keys) > 0 {
+				start, end = keySpan(line, c.keys[i], c.sep)
+			}
+			from, to, ok := c.usedSpan(line[start:end], opts)
+			if !ok && (opts.Numeric || opts.General || opts.Human) {
+				noValue(i)
+			}
+			notes = append(notes, underline(line, start+from, start+to, ok))
+		}
+	}
+
+	if c.lastResort && (len(c.keys) > 0 || c.opts[0] != KeyOptions{}) {
+		notes = append(notes, underline(line, 0, len(line), true))
+	}
+	return notes
+}
+
+// noValueWarnings возвращает предупреждения --debug о числе строк без числа
+// в каждом числовом ключе; counts - по ключам, без keys ключ - вся строка
+func noValueWarnings(counts []int, keys bool) []string {
+	var warnings []string
+	for i, n := range counts {
+		if n == 0 {
+			continue
+		}
+		msg := fmt.Sprintf("%d lines have no numeric value", n)
+		if n == 1 {
+			msg = "1 line has no numeric value"
+		}
+		if keys {
+			msg = fmt.Sprintf("key %d: %s", i+1, msg)
+		}
+		warnings = append(warnings, msg)
+	}
+	return warnings
+}
+
+// usedSpan возвращает часть ключа key, которая участвует в сравнении с модификаторами opts.
+// Для числовых ключей и месяцев это число или название месяца, false - если их нет.
+func (c *Comparator) usedSpan(key string, opts KeyOptions) (int, int, bool) {
+	begin := len(key) - len(strings.TrimLeft(key, " \t"))
+
+	switch {
+	case opts.Numeric:
+		_, end, ok := scanNumeric(key)
+		return begin, end, ok
+	case opts.General:
+		_, class, end := scanGeneral(key)
+		return begin, end, class > 0
+	case opts.Human:
+		_, end, ok := scanHuman(key)
+		return begin, end, ok
+	case opts.Month:
+		begin = len(key) - len(strings.TrimLeftFunc(key, unicode.IsSpace))
+		end := strings.IndexFunc(key[begin:], func(r rune) bool { return !unicode.IsLetter(r) })
+		if end < 0 {
+			end = len(key) - begin
+		}
+		return begin, begin + end, parseMonth(key, c.months) > 0
+	}
+	return 0, len(key), len(key) > 0
+}
+
+// underline строит строку с подчеркиваниями под line[start:end]
+// или с отметкой об отсутствии ключа в позиции start
+func underline(line string, start, end int, ok bool) string {
+	pad := strings.Repeat(" ", utf8.RuneCountInString(line[:start]))
+	if !ok {
+		return pad + "^ no match for key"
+	}
+	return pad + strings.Repeat("_", utf8.RuneCountInString(line[start:end]))
+}
+
+// debugLine возвращает строку для вывода с --debug, табы заменяются на '>'
+func debugLine(line string) string {
+	return strings.ReplaceAll(line, "\t", ">")
+}
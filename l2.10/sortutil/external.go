@@ -0,0 +1,375 @@
+package sortutil
+
+import (
+	"bufio"
+	"container/heap"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Sorter сортирует строки, добавленные через Add и AddFrom.
+// Строки накапливаются блоками не больше Options.BufferSize байт.
+// Переполненный блок сортируется и сбрасывается во временный файл (run),
+// в конце runs сливаются k-way слиянием, не больше Options.BatchSize за раз.
+// При BufferSize == 0 все строки сортируются в памяти.
+type Sorter struct {
+	opts  Options
+	delim byte
+	cmp   *Comparator
+	chunk []string
+	size  int64
+	runs  []string
+
+	header    string // заголовок первого входа при Options.Header
+	hasHeader bool
+}
+
+// NewSorter создает Sorter с параметрами opts
+func NewSorter(opts Options) (*Sorter, error) {
+	if opts.Parallel < 0 {
+		return nil, fmt.Errorf("invalid number of parallel sorts: %d", opts.Parallel)
+	}
+	cmp, err := NewComparator(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Sorter{opts: opts, delim: opts.delim(), cmp: cmp}, nil
+}
+
+// Add добавляет строку в текущий блок, при переполнении сбрасывает его на диск
+func (s *Sorter) Add(line string) error {
+	s.chunk = append(s.chunk, line)
+	s.size += int64(len(line)) + 1
+	if s.opts.BufferSize > 0 && s.size >= s.opts.BufferSize {
+		return s.spill()
+	}
+	return nil
+}
+
+// AddFrom добавляет все строки из r. С Options.Header первая строка r -
+// заголовок: заголовок первого входа выводится перед результатом, остальные пропускаются.
+func (s *Sorter) AddFrom(r io.Reader) error {
+	first := s.opts.Header
+	return scanLines(r, s.opts, func(line string) error {
+		if first {
+			first = false
+			return s.setHeader(line)
+		}
+		return s.Add(line)
+	})
+}
+
+// setHeader запоминает заголовок первого входа
+func (s *Sorter) setHeader(line string) error {
+	if s.hasHeader {
+		return nil
+	}
+	s.header, s.hasHeader = line, true
+	return s.cmp.setHeader(line)
+}
+
+// sortChunk сортирует текущий блок
+func (s *Sorter) sortChunk() []sortItem {
+	items := s.cmp.decorateAll(s.chunk)
+	parallelSort(items, s.cmp, s.opts.Parallel)
+	return items
+}
+
+// spill сортирует текущий блок и записывает его во временный файл
+func (s *Sorter) spill() error {
+	items := s.sortChunk()
+
+	f, err := os.CreateTemp(s.opts.TempDir, "sort-run-*")
+	if err != nil {
+		return fmt.Errorf("cannot create temp file: %w", err)
+	}
+	s.runs = append(s.runs, f.Name())
+
+	w := bufio.NewWriter(f)
+	for i := range items {
+		w.WriteString(items[i].line)
+		w.WriteByte(s.delim)
+	}
+	err = w.Flush()
+	errClose := f.Close()
+	if err != nil {
+		return fmt.Errorf("cannot write temp file: %w", err)
+	}
+	if errClose != nil {
+		return fmt.Errorf("cannot close temp file: %w", errClose)
+	}
+
+	clear(s.chunk)
+	s.chunk = s.chunk[:0]
+	s.size = 0
+	return nil
+}
+
+// WriteSorted выводит отсортированный результат в w
+func (s *Sorter) WriteSorted(w io.Writer) error {
+	out := newLineWriter(w, s.cmp, s.opts)
+	if s.hasHeader {
+		if err := out.writeLine(s.header); err != nil {
+			return err
+		}
+	}
+
+	if len(s.runs) == 0 {
+		items := s.sortChunk()
+		for i := range items {
+			if err := out.write(&items[i]); err != nil {
+				return err
+			}
+		}
+		return out.flush()
+	}
+
+	if len(s.chunk) > 0 {
+		if err := s.spill(); err != nil {
+			return err
+		}
+	}
+	if err := s.merge(out); err != nil {
+		return err
+	}
+	return out.flush()
+}
+
+// merge сливает отсортированные runs в out
+func (s *Sorter) merge(out *lineWriter) error {
+	// строки в runs уже прочитаны с обрезкой пробелов и проверкой длины
+	opts := s.opts
+	opts.TrimTrailingBlanks = false
+	opts.MaxLineSize = 0
+	opts.Header = false
+	return mergeFiles(slices.Clone(s.runs), out, opts, &s.runs)
+}
+
+// mergeFiles сливает отсортированные файлы names ("-" - STDIN) в out, открывая
+// одновременно не больше opts.batchSize() файлов. Если файлов больше, группы соседних
+// файлов сначала сливаются в промежуточные временные файлы, как в GNU sort --batch-size.
+// Группы идут в порядке names, поэтому равные строки остаются в порядке входов.
+// Созданные временные файлы добавляются в temps; файлы из temps, уже слитые дальше, удаляются.
+func mergeFiles(names []string, out *lineWriter, opts Options, temps *[]string) error {
+	batch := opts.batchSize()
+	for len(names) > batch {
+		var next []string
+		for i := 0; i < len(names); i += batch {
+			group := names[i:min(i+batch, len(names))]
+			name, err := mergeToTemp(group, out.cmp, opts, temps)
+			if err != nil {
+				return err
+			}
+			next = append(next, name)
+			removeMerged(group, temps)
+		}
+		names = next
+	}
+
+	return withOpenFiles(names, func(readers []io.Reader) error {
+		return mergeReaders(readers, out, opts)
+	})
+}
+
+// mergeToTemp сливает файлы names в новый временный файл без изменения строк
+// (без -u, --count и --debug) и возвращает его имя
+func mergeToTemp(names []string, cmp *Comparator, opts Options, temps *[]string) (string, error) {
+	f, err := os.CreateTemp(opts.TempDir, "sort-run-*")
+	if err != nil {
+		return "", fmt.Errorf("cannot create temp file: %w", err)
+	}
+	*temps = append(*temps, f.Name())
+
+	out := newLineWriter(f, cmp, Options{ZeroTerminated: opts.ZeroTerminated})
+	err = withOpenFiles(names, func(readers []io.Reader) error {
+		if err := mergeReaders(readers, out, opts); err != nil {
+			return err
+		}
+		return out.flush()
+	})
+	errClose := f.Close()
+	if err != nil {
+		return "", err
+	}
+	if errClose != nil {
+		return "", fmt.Errorf("cannot close temp file: %w", errClose)
+	}
+	return f.Name(), nil
+}
+
+// withOpenFiles открывает файлы names ("-" - STDIN), вызывает fn и закрывает их
+func withOpenFiles(names []string, fn func(readers []io.Reader) error) error {
+	readers := make([]io.Reader, 0, len(names))
+	for _, name := range names {
+		if name == "-" {
+			readers = append(readers, os.Stdin)
+			continue
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			return fmt.Errorf("cannot open file: %w", err)
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+	return fn(readers)
+}
+
+// removeMerged удаляет временные файлы из names, уже слитые в следующий файл
+func removeMerged(names []string, temps *[]string) {
+	*temps = slices.DeleteFunc(*temps, func(name string) bool {
+		if slices.Contains(names, name) {
+			os.Remove(name)
+			return true
+		}
+		return false
+	})
+}
+
+// mergeReaders сливает уже отсортированные потоки строк в out k-way слиянием.
+// Строки читаются так же, как scanLines с параметрами opts. С opts.Header
+// выводится заголовок первого потока, заголовки остальных пропускаются.
+func mergeReaders(readers []io.Reader, out *lineWriter, opts Options) error {
+	h := &runHeap{cmp: out.cmp}
+	hasHeader := false
+	for i, rd := range readers {
+		r := &runReader{scanner: newLineScanner(rd, opts), cmp: h.cmp, opts: opts, idx: i}
+		if opts.Header && r.scanner.Scan() && !hasHeader {
+			hasHeader = true
+			if err := out.cmp.setHeader(r.scanner.Text()); err != nil {
+				return err
+			}
+			if err := out.writeLine(r.scanner.Text()); err != nil {
+				return err
+			}
+		}
+		ok, err := r.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			h.runs = append(h.runs, r)
+		}
+	}
+	heap.Init(h)
+
+	for h.Len() > 0 {
+		r := h.runs[0]
+		if err := out.write(&r.item); err != nil {
+			return err
+		}
+		ok, err := r.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	return nil
+}
+
+// Close удаляет временные файлы
+func (s *Sorter) Close() error {
+	var errs []error
+	for _, name := range s.runs {
+		if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	s.runs = nil
+	return errors.Join(errs...)
+}
+
+// runReader читает строки одного run (или входного файла при -m)
+type runReader struct {
+	scanner *bufio.Scanner
+	cmp     *Comparator
+	opts    Options
+	item    sortItem
+	idx     int
+}
+
+// next читает следующую строку run, возвращает false, если run закончился
+func (r *runReader) next() (bool, error) {
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return false, scanError(err, r.opts)
+		}
+		return false, nil
+	}
+	line := r.scanner.Text()
+	if r.opts.TrimTrailingBlanks {
+		line = strings.TrimRight(line, " ")
+	}
+	r.item = r.cmp.decorate(line)
+	return true, nil
+}
+
+// runHeap - min-куча текущих строк runs, упорядоченная компаратором сортировки.
+// При равенстве строк первым идет run с меньшим индексом.
+type runHeap struct {
+	runs []*runReader
+	cmp  *Comparator
+}
+
+func (h *runHeap) Len() int { return len(h.runs) }
+
+func (h *runHeap) Less(i, j int) bool {
+	a, b := h.runs[i], h.runs[j]
+	if c := h.cmp.compare(&a.item, &b.item); c != 0 {
+		return c < 0
+	}
+	return a.idx < b.idx
+}
+
+func (h *runHeap) Swap(i, j int) { h.runs[i], h.runs[j] = h.runs[j], h.runs[i] }
+
+func (h *runHeap) Push(x any) { h.runs = append(h.runs, x.(*runReader)) }
+
+func (h *runHeap) Pop() any {
+	n := len(h.runs)
+	x := h.runs[n-1]
+	h.runs = h.runs[:n-1]
+	return x
+}
+
+// ParseBufferSize разбирает размер буфера для -S: число с необязательным
+// суффиксом b, K, M, G, T (без суффикса - килобайты, как в GNU sort)
+func ParseBufferSize(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	mult := int64(1024)
+	num := s
+	switch s[len(s)-1] {
+	case 'b', 'B':
+		mult = 1
+		num = s[:len(s)-1]
+	case 'K', 'k':
+		num = s[:len(s)-1]
+	case 'M', 'm':
+		mult = 1024 * 1024
+		num = s[:len(s)-1]
+	case 'G', 'g':
+		mult = 1024 * 1024 * 1024
+		num = s[:len(s)-1]
+	case 'T', 't':
+		mult = 1024 * 1024 * 1024 * 1024
+		num = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid buffer size: %q", s)
+	}
+	return n * mult, nil
+}
@@ -0,0 +1,185 @@
+package sortutil
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Format - формат входных записей
+type Format int
+
+const (
+	FormatText  Format = iota // строки текста, поля разделяются Separator или пробелами
+	FormatCSV                 // записи CSV, ключ - колонка по номеру или имени из заголовка
+	FormatJSONL               // JSON Lines, ключ - путь к значению (.user.age)
+)
+
+// ParseFormat разбирает название формата для --format: text, csv, jsonl
+func ParseFormat(s string) (Format, error) {
+	switch s {
+	case "", "text":
+		return FormatText, nil
+	case "csv":
+		return FormatCSV, nil
+	case "jsonl":
+		return FormatJSONL, nil
+	}
+	return FormatText, fmt.Errorf("invalid format: %q", s)
+}
+
+// ParseFormatKey разбирает описание ключа -k для формата f.
+// Для текста - как ParseKey. Для CSV - номер колонки в формате ParseKey ("2", "3n", "2,2")
+// или имя колонки из заголовка с модификаторами через двоеточие ("age:n").
+// Диапазоны колонок и позиции символов в CSV не поддерживаются.
+// Для JSON Lines - путь к значению с модификаторами (".user.age", ".name:f").
+func ParseFormatKey(s string, f Format) (Key, error) {
+	switch f {
+	case FormatCSV:
+		if k, err := ParseKey(s); err == nil {
+			if k.StartChar > 1 || k.EndChar != 0 || (k.EndField != 0 && k.EndField != k.StartField) {
+				return Key{}, fmt.Errorf("invalid CSV key: %q, must be a single column without character positions", s)
+			}
+			return k, nil
+		}
+		return parseNamedKey(s)
+	case FormatJSONL:
+		if !strings.HasPrefix(s, ".") {
+			return Key{}, fmt.Errorf("invalid JSON key: %q, must be a path starting with '.'", s)
+		}
+		return parseNamedKey(s)
+	}
+	return ParseKey(s)
+}
+
+// parseNamedKey разбирает ключ NAME[:OPTS]
+func parseNamedKey(s string) (Key, error) {
+	name, opts := s, ""
+	if i := strings.LastIndexByte(s, ':'); i >= 0 {
+		name, opts = s[:i], s[i+1:]
+	}
+	if name == "" {
+		return Key{}, fmt.Errorf("invalid key: %q", s)
+	}
+
+	k := Key{Name: name}
+	if err := k.parseOpts(opts); err != nil {
+		return Key{}, err
+	}
+	return k, nil
+}
+
+// splitCSVRecords возвращает SplitFunc для записей CSV, разделенных delim.
+// Разделитель внутри кавычек не завершает запись, поэтому поле с переводом
+// строки читается вместе со всей записью.
+func splitCSVRecords(delim byte) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		quoted := false
+		for i, b := range data {
+			switch {
+			case b == '"':
+				quoted = !quoted
+			case b == delim && !quoted:
+				return i + 1, dropCR(data[:i], delim), nil
+			}
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), dropCR(data, delim), nil
+		}
+		return 0, nil, nil
+	}
+}
+
+// dropCR отбрасывает \r в конце записи, разделенной переводом строки
+func dropCR(data []byte, delim byte) []byte {
+	if delim == '\n' && len(data) > 0 && data[len(data)-1] == '\r' {
+		return data[:len(data)-1]
+	}
+	return data
+}
+
+// csvComma возвращает разделитель колонок CSV: Separator из одного символа или запятую
+func csvComma(sep string) rune {
+	if r, size := utf8.DecodeRuneInString(sep); size > 0 && size == len(sep) {
+		return r
+	}
+	return ','
+}
+
+// csvFields разбирает запись CSV на колонки с учетом кавычек.
+// Некорректные кавычки допускаются, запись с ошибкой разбора не имеет колонок.
+func csvFields(record string, comma rune) []string {
+	r := csv.NewReader(strings.NewReader(record))
+	r.Comma = comma
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	fields, err := r.Read()
+	if err != nil {
+		return nil
+	}
+	return fields
+}
+
+// Типы значений ключей JSON в порядке сортировки. Для текста и CSV тип
+// всегда jsonMissing, и значения сравниваются только как строки.
+const (
+	jsonMissing = iota // значения нет или строка - не JSON
+	jsonNull
+	jsonBool
+	jsonNumber
+	jsonString
+	jsonOther // объекты и массивы сравниваются как текст JSON
+)
+
+// parseJSON разбирает строку JSON Lines, числа остаются json.Number
+func parseJSON(line string) (any, bool) {
+	d := json.NewDecoder(strings.NewReader(line))
+	d.UseNumber()
+	var v any
+	if err := d.Decode(&v); err != nil {
+		return nil, false
+	}
+	return v, true
+}
+
+// lookupJSON возвращает текст и тип значения по пути вида .user.age или .items.0
+func lookupJSON(doc any, path string) (string, int) {
+	v := doc
+	for _, name := range strings.Split(strings.TrimPrefix(path, "."), ".") {
+		if name == "" {
+			continue
+		}
+		switch x := v.(type) {
+		case map[string]any:
+			var ok bool
+			if v, ok = x[name]; !ok {
+				return "", jsonMissing
+			}
+		case []any:
+			i, err := strconv.Atoi(name)
+			if err != nil || i < 0 || i >= len(x) {
+				return "", jsonMissing
+			}
+			v = x[i]
+		default:
+			return "", jsonMissing
+		}
+	}
+
+	switch x := v.(type) {
+	case nil:
+		return "", jsonNull
+	case bool:
+		return strconv.FormatBool(x), jsonBool
+	case json.Number:
+		return x.String(), jsonNumber
+	case string:
+		return x, jsonString
+	}
+	data, _ := json.Marshal(v)
+	return string(data), jsonOther
+}
@@ -0,0 +1,54 @@
+package sortutil
+
+import (
+	"math"
+	"strings"
+)
+
+// humanSuffixes - суффиксы размеров для -h в порядке возрастания степени
+const humanSuffixes = "KMGTPE"
+
+// parseHuman разбирает человекочитаемый размер в начале строки: "10K", "1.5Gi",
+// "-2MB", "512KiB". Текст после суффикса игнорируется, как и в GNU sort.
+// Возвращает false, если строка не начинается с числа.
+func parseHuman(s string) (float64, bool) {
+	v, _, ok := scanHuman(s)
+	return v, ok
+}
+
+// scanHuman разбирает размер в начале s и возвращает его значение и конец размера
+// вместе с суффиксом в s
+func scanHuman(s string) (float64, int, bool) {
+	v, end, ok := scanNumeric(s)
+	if !ok {
+		return 0, 0, false
+	}
+	mult, n := humanSuffix(s[end:])
+	return v * mult, end + n, true
+}
+
+// humanSuffix возвращает множитель суффикса размера в начале s и длину суффикса.
+// K, Ki, KiB - степени 1024 (как в du -h и IEC), KB и kB - степени 1000 (SI), B - байты.
+// Строчная e не считается суффиксом, чтобы не путать ее с экспонентой.
+func humanSuffix(s string) (float64, int) {
+	if s == "" || s[0] == 'e' {
+		return 1, 0
+	}
+	if s[0] == 'B' {
+		return 1, 1
+	}
+	exp := strings.IndexByte(humanSuffixes, s[0]&^0x20) // к верхнему регистру
+	if exp < 0 {
+		return 1, 0
+	}
+
+	switch {
+	case strings.HasPrefix(s[1:], "iB"):
+		return math.Pow(1024, float64(exp+1)), 3
+	case strings.HasPrefix(s[1:], "i"):
+		return math.Pow(1024, float64(exp+1)), 2
+	case strings.HasPrefix(s[1:], "B"):
+		return math.Pow(1000, float64(exp+1)), 2
+	}
+	return math.Pow(1024, float64(exp+1)), 1
+}
@@ -0,0 +1,203 @@
+package sortutil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ParseKey разбирает описание ключа в формате -k: "2", "2,3", "2.3,2.5", "3n,3", "1,1r"
+func ParseKey(s string) (Key, error) {
+	var k Key
+
+	startStr, endStr, hasEnd := strings.Cut(s, ",")
+
+	field, char, rest, err := parseKeyPos(startStr)
+	if err != nil || field < 1 || char < 0 {
+		return k, fmt.Errorf("invalid key position: %q", s)
+	}
+	// в начале ключа позиция символа считается с 1, .0 допустим только в конце
+	if char == 0 {
+		if strings.Contains(startStr[:len(startStr)-len(rest)], ".") {
+			return k, fmt.Errorf("invalid key position: %q: character offset is zero", s)
+		}
+		char = 1
+	}
+	k.StartField, k.StartChar = field, char
+	if err := k.parseOpts(rest); err != nil {
+		return k, err
+	}
+
+	if hasEnd {
+		field, char, rest, err = parseKeyPos(endStr)
+		if err != nil || field < 1 || char < 0 {
+			return k, fmt.Errorf("invalid key position: %q", s)
+		}
+		k.EndField, k.EndChar = field, char
+		if err := k.parseOpts(rest); err != nil {
+			return k, err
+		}
+	}
+
+	return k, nil
+}
+
+// parseKeyPos разбирает позицию F[.C] и возвращает оставшиеся модификаторы
+func parseKeyPos(s string) (field, char int, opts string, err error) {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	field, err = strconv.Atoi(s[:i])
+	if err != nil {
+		return 0, 0, "", err
+	}
+	s = s[i:]
+
+	if strings.HasPrefix(s, ".") {
+		i = 1
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		char, err = strconv.Atoi(s[1:i])
+		if err != nil {
+			return 0, 0, "", err
+		}
+		s = s[i:]
+	}
+
+	return field, char, s, nil
+}
+
+// parseOpts применяет модификаторы ключа
+func (k *Key) parseOpts(opts string) error {
+	for _, c := range opts {
+		switch c {
+		case 'n':
+			k.Options.Numeric = true
+		case 'g':
+			k.Options.General = true
+		case 'V':
+			k.Options.Version = true
+		case 'M':
+			k.Options.Month = true
+		case 'h':
+			k.Options.Human = true
+		case 'R':
+			k.Options.Random = true
+		case 'r':
+			k.Options.Reverse = true
+		case 'b':
+			k.Options.IgnoreBlanks = true
+		case 'f':
+			k.Options.FoldCase = true
+		case 'd':
+			k.Options.Dictionary = true
+		default:
+			return fmt.Errorf("invalid key option %q", c)
+		}
+		k.HasOptions = true
+	}
+	return nil
+}
+
+// options возвращает модификаторы ключа, без собственных - глобальные
+func (k Key) options(global KeyOptions) KeyOptions {
+	if k.HasOptions {
+		return k.Options
+	}
+	return global
+}
+
+// fieldBounds возвращает границы полей строки [start, end).
+// С разделителем sep поля разделяются им, без него - как в GNU sort:
+// поле состоит из ведущих пробелов и следующих за ними непробельных символов.
+func fieldBounds(line, sep string) [][2]int {
+	var bounds [][2]int
+
+	if sep == "" {
+		start := 0
+		for start < len(line) {
+			end := skipBlanks(line, start, len(line))
+			for end < len(line) && !isBlank(line[end]) {
+				end++
+			}
+			bounds = append(bounds, [2]int{start, end})
+			start = end
+		}
+		return bounds
+	}
+
+	start := 0
+	for {
+		i := strings.Index(line[start:], sep)
+		if i < 0 {
+			bounds = append(bounds, [2]int{start, len(line)})
+			return bounds
+		}
+		bounds = append(bounds, [2]int{start, start + i})
+		start += i + len(sep)
+	}
+}
+
+// extractKey извлекает ключ k из строки для сортировки
+func extractKey(line string, k Key, sep string) string {
+	start, end := keySpan(line, k, sep)
+	return line[start:end]
+}
+
+// keySpan возвращает границы ключа k в строке [start, end), пустой ключ - start == end
+func keySpan(line string, k Key, sep string) (int, int) {
+	fields := fieldBounds(line, sep)
+	if k.StartField > len(fields) {
+		return len(line), len(line)
+	}
+
+	f := fields[k.StartField-1]
+	start := f[0]
+	if k.Options.IgnoreBlanks {
+		start = skipBlanks(line, start, f[1])
+	}
+	start = advanceRunes(line, start, f[1], k.StartChar-1)
+
+	end := len(line)
+	if k.EndField > 0 && k.EndField <= len(fields) {
+		f = fields[k.EndField-1]
+		end = f[1]
+		if k.EndChar > 0 {
+			pos := f[0]
+			if k.Options.IgnoreBlanks {
+				pos = skipBlanks(line, pos, f[1])
+			}
+			end = advanceRunes(line, pos, f[1], k.EndChar)
+		}
+	}
+
+	if end <= start {
+		return start, start
+	}
+	return start, end
+}
+
+// skipBlanks пропускает пробелы и табы начиная с pos, но не дальше limit
+func skipBlanks(s string, pos, limit int) int {
+	for pos < limit && isBlank(s[pos]) {
+		pos++
+	}
+	return pos
+}
+
+// isBlank проверяет, является ли символ пробелом или табом
+func isBlank(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+// advanceRunes сдвигает pos на n символов, но не дальше limit
+func advanceRunes(s string, pos, limit, n int) int {
+	for ; n > 0 && pos < limit; n-- {
+		_, size := utf8.DecodeRuneInString(s[pos:])
+		pos += size
+	}
+	return min(pos, limit)
+}
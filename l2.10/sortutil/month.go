@@ -0,0 +1,85 @@
+package sortutil
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Months - названия месяцев одного языка для -M: для каждого месяца с января
+// полные названия и сокращения. Регистр не учитывается.
+type Months [12][]string
+
+var (
+	monthsMu      sync.RWMutex
+	monthLocales  = map[string]Months{}
+	monthDefaults []string // языки в порядке регистрации
+)
+
+func init() {
+	RegisterMonths("en", Months{
+		{"january", "jan"}, {"february", "feb"}, {"march", "mar"}, {"april", "apr"},
+		{"may"}, {"june", "jun"}, {"july", "jul"}, {"august", "aug"},
+		{"september", "sep", "sept"}, {"october", "oct"}, {"november", "nov"}, {"december", "dec"},
+	})
+	RegisterMonths("ru", Months{
+		{"январь", "января", "янв"}, {"февраль", "февраля", "фев", "февр"},
+		{"март", "марта", "мар"}, {"апрель", "апреля", "апр"},
+		{"май", "мая"}, {"июнь", "июня", "июн"},
+		{"июль", "июля", "июл"}, {"август", "августа", "авг"},
+		{"сентябрь", "сентября", "сен", "сент"}, {"октябрь", "октября", "окт"},
+		{"ноябрь", "ноября", "ноя", "нояб"}, {"декабрь", "декабря", "дек"},
+	})
+}
+
+// RegisterMonths добавляет (или заменяет) названия месяцев языка lang.
+// Без Options.MonthLocales -M распознает месяцы всех зарегистрированных языков.
+func RegisterMonths(lang string, months Months) {
+	monthsMu.Lock()
+	defer monthsMu.Unlock()
+
+	if _, ok := monthLocales[lang]; !ok {
+		monthDefaults = append(monthDefaults, lang)
+	}
+	monthLocales[lang] = months
+}
+
+// monthTable строит таблицу "название в нижнем регистре - номер месяца" для языков langs,
+// без langs - для всех зарегистрированных. При совпадении названий побеждает первый язык.
+func monthTable(langs []string) (map[string]int, error) {
+	monthsMu.RLock()
+	defer monthsMu.RUnlock()
+
+	if len(langs) == 0 {
+		langs = monthDefaults
+	}
+
+	table := make(map[string]int)
+	for _, lang := range langs {
+		months, ok := monthLocales[lang]
+		if !ok {
+			return nil, fmt.Errorf("unknown month locale %q", lang)
+		}
+		for i, names := range months {
+			for _, name := range names {
+				name = strings.ToLower(name)
+				if _, dup := table[name]; !dup {
+					table[name] = i + 1
+				}
+			}
+		}
+	}
+	return table, nil
+}
+
+// parseMonth возвращает номер месяца по первому слову s без учета регистра
+// и ведущих пробелов, 0 - если месяц не опознан
+func parseMonth(s string, table map[string]int) int {
+	s = strings.TrimLeftFunc(s, unicode.IsSpace)
+	end := strings.IndexFunc(s, func(r rune) bool { return !unicode.IsLetter(r) })
+	if end >= 0 {
+		s = s[:end]
+	}
+	return table[strings.ToLower(s)]
+}
@@ -0,0 +1,81 @@
+package sortutil
+
+// KeyOptions - модификаторы сравнения ключа
+type KeyOptions struct {
+	Numeric      bool // n - по числовому значению
+	General      bool // g - по числовому значению с плавающей точкой (1e3, inf, NaN)
+	Version      bool // V - как номера версий
+	Month        bool // M - по названию месяца
+	Human        bool // h - по человекочитаемому размеру (1K, 2M)
+	Random       bool // R - в случайном порядке по хешу ключа, равные ключи остаются рядом
+	Reverse      bool // r - в обратном порядке
+	IgnoreBlanks bool // b - игнорировать ведущие пробелы ключа
+	FoldCase     bool // f - без учета регистра
+	Dictionary   bool // d - только пробелы, буквы и цифры
+}
+
+// Key - ключ сортировки в формате POSIX: -k POS1[,POS2], где POS = F[.C][OPTS].
+// Поля и символы нумеруются с 1, EndField == 0 означает конец строки,
+// EndChar == 0 - конец поля EndField.
+// В CSV ключ - одна колонка StartField или Name, в JSON Lines - значение по пути Name.
+type Key struct {
+	StartField int
+	StartChar  int
+	EndField   int
+	EndChar    int
+	Name       string // имя колонки CSV из заголовка или путь JSON (.user.age)
+	Options    KeyOptions
+	HasOptions bool // указаны собственные модификаторы, глобальные не применяются
+}
+
+// Options - параметры сортировки
+type Options struct {
+	// KeyOptions - глобальные модификаторы, применяются ко всей строке
+	// без Keys и к ключам без собственных модификаторов
+	KeyOptions
+
+	Keys      []Key  // ключи сортировки, сравниваются по порядку
+	Separator string // разделитель полей (в CSV - колонок, по умолчанию запятая), пустой - переход от пробелов к непробельным символам
+	Format    Format // формат записей: текст, CSV или JSON Lines
+	Header    bool   // первая запись каждого входа - заголовок, он выводится первым и не сортируется
+
+	Stable             bool     // сохранять исходный порядок строк с равными ключами
+	Unique             bool     // выводить только первую строку из группы с равными ключами
+	Count              bool     // как Unique, но с размером группы перед строкой
+	TrimTrailingBlanks bool     // отбрасывать пробелы в конце строк при чтении
+	Locale             string   // Unicode collation для сравнения строк (например, ru, en)
+	Debug              bool     // размечать под каждой выведенной строкой части, использованные при сравнении
+	MonthLocales       []string // языки названий месяцев для Month (см. RegisterMonths), пустой - все
+	RandomSeed         uint64   // зерно хеша для Random, одно и то же зерно дает один и тот же порядок
+
+	// Warn с Debug получает предупреждения о данных, найденные при выводе,
+	// например о строках без числа в числовом ключе; nil - предупреждения не выводятся
+	Warn func(msg string)
+
+	ZeroTerminated bool // строки разделяются байтом NUL, а не переводом строки
+	MaxLineSize    int  // максимальная длина строки в байтах, 0 - без ограничения
+
+	BufferSize int64  // размер буфера в байтах, при превышении блоки сбрасываются на диск; 0 - без ограничения
+	TempDir    string // каталог для временных файлов, пустой - os.TempDir()
+	Parallel   int    // число горутин сортировки, 0 и 1 - одна
+	BatchSize  int    // сколько файлов сливается за раз, 0 - DefaultBatchSize
+}
+
+// DefaultBatchSize - сколько файлов по умолчанию сливается за раз, как в GNU sort
+const DefaultBatchSize = 16
+
+// batchSize возвращает, сколько файлов сливается за раз
+func (o Options) batchSize() int {
+	if o.BatchSize < 2 {
+		return DefaultBatchSize
+	}
+	return o.BatchSize
+}
+
+// delim возвращает разделитель строк на входе и выходе
+func (o Options) delim() byte {
+	if o.ZeroTerminated {
+		return 0
+	}
+	return '\n'
+}
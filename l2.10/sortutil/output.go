@@ -0,0 +1,119 @@
+package sortutil
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// lineWriter выводит отсортированные строки. С Unique из каждой группы строк
+// с равными ключами выводится только первая, с Count перед ней выводится размер группы.
+type lineWriter struct {
+	w      *bufio.Writer
+	cmp    *Comparator
+	delim  byte
+	unique bool
+	count  bool
+	debug  bool
+	prev   sortItem
+	n      int
+
+	warn    func(msg string)
+	noValue []int // с debug - сколько выведенных строк без числа в каждом числовом ключе
+}
+
+// newLineWriter создает lineWriter, сравнивающий ключи с помощью cmp
+func newLineWriter(w io.Writer, cmp *Comparator, opts Options) *lineWriter {
+	return &lineWriter{
+		w:      bufio.NewWriter(w),
+		cmp:    cmp,
+		delim:  opts.delim(),
+		unique: opts.Unique || opts.Count,
+		count:  opts.Count,
+		debug:  opts.Debug,
+		warn:   opts.Warn,
+	}
+}
+
+// write выводит строку или добавляет ее в текущую группу равных ключей
+func (lw *lineWriter) write(item *sortItem) error {
+	if !lw.unique {
+		return lw.writeRecord(item.line, "")
+	}
+
+	if lw.n > 0 && lw.cmp.compareKeys(&lw.prev, item) == 0 {
+		lw.n++
+		return nil
+	}
+	if err := lw.writeGroup(); err != nil {
+		return err
+	}
+	lw.prev = *item
+	lw.n = 1
+	return nil
+}
+
+// writeGroup выводит первую строку текущей группы
+func (lw *lineWriter) writeGroup() error {
+	if lw.n == 0 {
+		return nil
+	}
+	var prefix string
+	if lw.count {
+		prefix = fmt.Sprintf("%7d ", lw.n)
+	}
+	lw.n = 0
+	return lw.writeRecord(lw.prev.line, prefix)
+}
+
+// writeRecord выводит строку с префиксом, с debug - вместе с разметкой ключей
+func (lw *lineWriter) writeRecord(line, prefix string) error {
+	if _, err := lw.w.WriteString(prefix); err != nil {
+		return err
+	}
+	if !lw.debug {
+		return lw.writeLine(line)
+	}
+
+	if err := lw.writeLine(debugLine(line)); err != nil {
+		return err
+	}
+	indent := strings.Repeat(" ", len(prefix))
+	notes := lw.cmp.annotate(line, func(key int) {
+		if lw.noValue == nil {
+			lw.noValue = make([]int, len(lw.cmp.opts))
+		}
+		lw.noValue[key]++
+	})
+	for _, note := range notes {
+		if err := lw.writeLine(indent + note); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (lw *lineWriter) writeLine(line string) error {
+	if _, err := lw.w.WriteString(line); err != nil {
+		return err
+	}
+	return lw.w.WriteByte(lw.delim)
+}
+
+// flush выводит последнюю группу, сбрасывает буфер и передает в warn
+// предупреждения о строках без числа в числовых ключах
+func (lw *lineWriter) flush() error {
+	if err := lw.writeGroup(); err != nil {
+		return err
+	}
+	if err := lw.w.Flush(); err != nil {
+		return err
+	}
+	if lw.warn != nil {
+		for _, msg := range noValueWarnings(lw.noValue, len(lw.cmp.keys) > 0) {
+			lw.warn(msg)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package sortutil
+
+import (
+	"sort"
+	"sync"
+)
+
+// minParallelChunk - минимальный размер части, меньшие входы сортируются в одной горутине
+const minParallelChunk = 1024
+
+// parallelSort делит строки на workers частей, сортирует их конкурентно
+// и попарно сливает результат. При равенстве строк слияние берет элемент
+// из левой части, поэтому со Stable результат совпадает с последовательной сортировкой.
+func parallelSort(lines []sortItem, c *Comparator, workers int) {
+	if workers > len(lines)/minParallelChunk {
+		workers = len(lines) / minParallelChunk
+	}
+	if workers <= 1 {
+		sortSequential(lines, c)
+		return
+	}
+
+	size := (len(lines) + workers - 1) / workers
+	var parts [][2]int
+	for start := 0; start < len(lines); start += size {
+		parts = append(parts, [2]int{start, min(start+size, len(lines))})
+	}
+
+	var wg sync.WaitGroup
+	for _, p := range parts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sortSequential(lines[p[0]:p[1]], c)
+		}()
+	}
+	wg.Wait()
+
+	src, dst := lines, make([]sortItem, len(lines))
+	for len(parts) > 1 {
+		var merged [][2]int
+		for i := 0; i < len(parts); i += 2 {
+			if i+1 == len(parts) {
+				p := parts[i]
+				copy(dst[p[0]:p[1]], src[p[0]:p[1]])
+				merged = append(merged, p)
+				continue
+			}
+
+			left, right := parts[i], parts[i+1]
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				mergeSorted(dst[left[0]:right[1]], src[left[0]:left[1]], src[right[0]:right[1]], c)
+			}()
+			merged = append(merged, [2]int{left[0], right[1]})
+		}
+		wg.Wait()
+
+		parts = merged
+		src, dst = dst, src
+	}
+
+	if &src[0] != &lines[0] {
+		copy(lines, src)
+	}
+}
+
+// mergeSorted сливает отсортированные a и b в dst, при равенстве первым идет элемент из a
+func mergeSorted(dst, a, b []sortItem, c *Comparator) {
+	i, j, k := 0, 0, 0
+	for i < len(a) && j < len(b) {
+		if c.compare(&b[j], &a[i]) < 0 {
+			dst[k] = b[j]
+			j++
+		} else {
+			dst[k] = a[i]
+			i++
+		}
+		k++
+	}
+	k += copy(dst[k:], a[i:])
+	copy(dst[k:], b[j:])
+}
+
+// sortSequential сортирует строки в одной горутине, со Stable сохраняя исходный порядок равных
+func sortSequential(lines []sortItem, c *Comparator) {
+	less := func(i, j int) bool {
+		return c.compare(&lines[i], &lines[j]) < 0
+	}
+	if c.stable {
+		sort.SliceStable(lines, less)
+	} else {
+		sort.Slice(lines, less)
+	}
+}
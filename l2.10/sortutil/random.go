@@ -0,0 +1,28 @@
+package sortutil
+
+// randomHash - хеш ключа для -R: FNV-1a, начатый с зерна seed, с перемешиванием
+// финализатором splitmix64. Равные ключи получают равный хеш и оказываются рядом,
+// одинаковое зерно дает одинаковый порядок.
+func randomHash(seed uint64, s string) uint64 {
+	const (
+		offset = 14695981039346656037
+		prime  = 1099511628211
+	)
+
+	h := uint64(offset)
+	for i := range 8 {
+		h ^= (seed >> (8 * i)) & 0xff
+		h *= prime
+	}
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= prime
+	}
+
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
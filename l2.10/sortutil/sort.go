@@ -0,0 +1,132 @@
+// Package sortutil реализует сортировку строк в стиле GNU sort:
+// ключи -k, числовые, месячные, версионные и человекочитаемые сравнения,
+// сортировку со сбросом на диск, параллельную сортировку, слияние и проверку порядка.
+package sortutil
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// ErrLineTooLong возвращается, если строка на входе длиннее Options.MaxLineSize
+var ErrLineTooLong = errors.New("line too long")
+
+// Sort сортирует строки из r с параметрами opts и выводит результат в w
+func Sort(r io.Reader, w io.Writer, opts Options) error {
+	s, err := NewSorter(opts)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if err := s.AddFrom(r); err != nil {
+		return err
+	}
+	return s.WriteSorted(w)
+}
+
+// Merge сливает уже отсортированные с параметрами opts потоки строк в w, не сортируя их заново
+func Merge(readers []io.Reader, w io.Writer, opts Options) error {
+	cmp, err := NewComparator(opts)
+	if err != nil {
+		return err
+	}
+
+	out := newLineWriter(w, cmp, opts)
+	if err := mergeReaders(readers, out, opts); err != nil {
+		return err
+	}
+	return out.flush()
+}
+
+// MergeFiles сливает уже отсортированные файлы names ("-" - STDIN) в w, как Merge,
+// но открывает одновременно не больше Options.BatchSize файлов: остальные
+// предварительно сливаются группами во временные файлы в Options.TempDir
+func MergeFiles(names []string, w io.Writer, opts Options) error {
+	cmp, err := NewComparator(opts)
+	if err != nil {
+		return err
+	}
+
+	var temps []string
+	defer func() {
+		for _, name := range temps {
+			os.Remove(name)
+		}
+	}()
+
+	out := newLineWriter(w, cmp, opts)
+	if err := mergeFiles(names, out, opts, &temps); err != nil {
+		return err
+	}
+	return out.flush()
+}
+
+// scanLines читает строки из r, разделенные opts.delim(),
+// с opts.TrimTrailingBlanks удаляя пробелы в конце строк
+func scanLines(r io.Reader, opts Options, fn func(line string) error) error {
+	scanner := newLineScanner(r, opts)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if opts.TrimTrailingBlanks {
+			line = strings.TrimRight(line, " ")
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return scanError(err, opts)
+	}
+	return nil
+}
+
+// newLineScanner создает Scanner строк r, разделенных opts.delim().
+// В CSV разделитель внутри кавычек не завершает запись.
+// Буфер растет до opts.MaxLineSize, при нулевом MaxLineSize длина строки не ограничена.
+func newLineScanner(r io.Reader, opts Options) *bufio.Scanner {
+	limit := math.MaxInt
+	if opts.MaxLineSize > 0 {
+		limit = opts.MaxLineSize + 1 // строка вместе с разделителем
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, min(bufio.MaxScanTokenSize, limit)), limit)
+	if opts.Format == FormatCSV {
+		scanner.Split(splitCSVRecords(opts.delim()))
+	} else {
+		scanner.Split(splitLines(opts.delim()))
+	}
+	return scanner
+}
+
+// splitLines возвращает SplitFunc для строк, разделенных delim.
+// Для перевода строки, как и bufio.ScanLines, отбрасывает \r в конце строки.
+func splitLines(delim byte) bufio.SplitFunc {
+	if delim == '\n' {
+		return bufio.ScanLines
+	}
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, delim); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+}
+
+// scanError оборачивает ошибку чтения строк
+func scanError(err error, opts Options) error {
+	if errors.Is(err, bufio.ErrTooLong) {
+		return fmt.Errorf("%w: exceeds %d bytes", ErrLineTooLong, opts.MaxLineSize)
+	}
+	return fmt.Errorf("cannot read input: %w", err)
+}
@@ -0,0 +1,1877 @@
+package sortutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// mustKeys разбирает описания ключей так же, как флаги -k
+func mustKeys(tb testing.TB, specs ...string) []Key {
+	tb.Helper()
+	var keys []Key
+	for _, spec := range specs {
+		k, err := ParseKey(spec)
+		if err != nil {
+			tb.Fatalf("ParseKey(%q): %v", spec, err)
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// mustComparator строит Comparator по opts
+func mustComparator(tb testing.TB, opts Options) *Comparator {
+	tb.Helper()
+	c, err := NewComparator(opts)
+	if err != nil {
+		tb.Fatalf("NewComparator: %v", err)
+	}
+	return c
+}
+
+// lessSort возвращает функцию сравнения строк для sort.Slice
+func lessSort(tb testing.TB, lines []string, opts Options) func(i, j int) bool {
+	c := mustComparator(tb, opts)
+	return func(i, j int) bool {
+		return c.Compare(lines[i], lines[j]) < 0
+	}
+}
+
+// sortLines сортирует строки так же, как Sorter: с однократным разбором ключей
+// и с opts.Parallel горутинами
+func sortLines(tb testing.TB, lines []string, opts Options) {
+	c := mustComparator(tb, opts)
+	items := c.decorateAll(lines)
+	parallelSort(items, c, opts.Parallel)
+	for i := range items {
+		lines[i] = items[i].line
+	}
+}
+
+// checkSorted проверяет порядок строк через Check
+func checkSorted(tb testing.TB, lines []string, opts Options) error {
+	var buf strings.Builder
+	for _, l := range lines {
+		buf.WriteString(l)
+		buf.WriteByte('\n')
+	}
+	return Check(strings.NewReader(buf.String()), "-", opts)
+}
+
+// TestExtractKey проверяет функцию extractKey
+func TestExtractKey(t *testing.T) {
+	tests := []struct {
+		line string
+		sep  string
+		spec string
+		want string
+	}{
+		{"foo\tbar\tbaz", "\t", "1", "foo\tbar\tbaz"}, // с первой колонки до конца строки
+		{"foo\tbar\tbaz", "\t", "1,1", "foo"},         // первая колонка
+		{"foo\tbar\tbaz", "\t", "2,2", "bar"},         // вторая колонка
+		{"foo\tbar\tbaz", "\t", "3,3", "baz"},         // третья колонка
+		{"foo\tbar\tbaz", "\t", "2", "bar\tbaz"},      // со второй колонки до конца строки
+		{"foo\tbar\tbaz", "\t", "1,2", "foo\tbar"},    // первые две колонки
+		{"foo\tbar\tbaz", "\t", "4", ""},              // колонки нет
+		{"foo\tbar\tbaz", "\t", "2.2,2.3", "ar"},      // символы внутри колонки
+		{"foo\tbar\tbaz", "\t", "1.2,3.1", "oo\tbar\tb"},
+		{"foo\tbar\tbaz", "\t", "2.5,2", ""}, // начало за концом колонки
+
+		// разделитель по умолчанию: ведущие пробелы относятся к полю
+		{"foo bar baz", "", "2,2", " bar"},
+		{"foo   bar\tbaz", "", "2,2", "   bar"},
+		{"foo   bar\tbaz", "", "3,3", "\tbaz"},
+		{"  foo bar", "", "1,1", "  foo"},
+		{"foo   bar", "", "2.4,2", "bar"},
+		{"foo   bar", "", "2b,2", "bar"},
+		{"", "", "1", ""},
+
+		// произвольный разделитель
+		{"a,b,,d", ",", "2,2", "b"},
+		{"a,b,,d", ",", "3,3", ""},
+		{"a,b,,d", ",", "4,4", "d"},
+		{"root:x:0:0", ":", "3,3", "0"},
+		{"a b c", " ", "2,2", "b"},
+		{"a  b", " ", "3,3", "b"}, // каждый пробел разделяет поля
+		{"a::b::c", "::", "2", "b::c"},
+	}
+
+	for _, tt := range tests {
+		k, err := ParseKey(tt.spec)
+		if err != nil {
+			t.Fatalf("ParseKey(%q): %v", tt.spec, err)
+		}
+		got := extractKey(tt.line, k, tt.sep)
+		if got != tt.want {
+			t.Errorf("extractKey(%q, %q) with -t %q = %q, want %q", tt.line, tt.spec, tt.sep, got, tt.want)
+		}
+	}
+}
+
+// TestExtractKeyBlanks проверяет модификатор b и позиции в символах UTF-8
+func TestExtractKeyBlanks(t *testing.T) {
+	tests := []struct {
+		line string
+		spec string
+		want string
+	}{
+		{"x\t  abc", "2,2", "  abc"},
+		{"x\t  abc", "2b,2", "abc"},
+		{"x\t  abc", "2.2b,2", "bc"},
+		{"x\tпятка", "2.2,2.3", "ят"},
+	}
+
+	for _, tt := range tests {
+		k, err := ParseKey(tt.spec)
+		if err != nil {
+			t.Fatalf("ParseKey(%q): %v", tt.spec, err)
+		}
+		got := extractKey(tt.line, k, "\t")
+		if got != tt.want {
+			t.Errorf("extractKey(%q, %q) = %q, want %q", tt.line, tt.spec, got, tt.want)
+		}
+	}
+}
+
+// TestParseKeySpec проверяет разбор описания ключа
+func TestParseKeySpec(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Key
+		wantErr bool
+	}{
+		{in: "2", want: Key{StartField: 2, StartChar: 1}},
+		{in: "2,3", want: Key{StartField: 2, StartChar: 1, EndField: 3}},
+		{in: "2.3,2.5", want: Key{StartField: 2, StartChar: 3, EndField: 2, EndChar: 5}},
+		{in: "3n,3", want: Key{StartField: 3, StartChar: 1, EndField: 3, Options: KeyOptions{Numeric: true}, HasOptions: true}},
+		{in: "1,1rM", want: Key{StartField: 1, StartChar: 1, EndField: 1, Options: KeyOptions{Reverse: true, Month: true}, HasOptions: true}},
+		{in: "2R", want: Key{StartField: 2, StartChar: 1, Options: KeyOptions{Random: true}, HasOptions: true}},
+		{in: "1bf", want: Key{StartField: 1, StartChar: 1, Options: KeyOptions{IgnoreBlanks: true, FoldCase: true}, HasOptions: true}},
+		{in: "", wantErr: true},
+		{in: "0", wantErr: true},
+		{in: "a", wantErr: true},
+		{in: "1x", wantErr: true},
+		{in: "1,", wantErr: true},
+		{in: "1.0", wantErr: true},
+		{in: "1.0n,2", wantErr: true},
+		{in: "1,2.0", want: Key{StartField: 1, StartChar: 1, EndField: 2}},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseKey(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseKey(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("ParseKey(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestSortLastResort проверяет, что строки с равными ключами сравниваются целиком
+func TestSortLastResort(t *testing.T) {
+	var opts Options
+	opts.Keys = mustKeys(t, "1,1")
+
+	lines := []string{"a c", "b a", "a b", "a a"}
+	sortLines(t, lines, opts)
+
+	want := []string{"a a", "a b", "a c", "b a"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("last-resort sort mismatch: got %v, want %v", lines, want)
+	}
+
+	opts.Reverse = true
+	sortLines(t, lines, opts)
+
+	want = []string{"b a", "a c", "a b", "a a"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("reverse last-resort sort mismatch: got %v, want %v", lines, want)
+	}
+}
+
+// TestSortStable проверяет, что с -s строки с равными ключами сохраняют исходный порядок
+func TestSortStable(t *testing.T) {
+	var opts Options
+	opts.Stable = true
+	opts.Keys = mustKeys(t, "1,1")
+
+	lines := make([]string, 0, 200)
+	for i := range 100 {
+		lines = append(lines, fmt.Sprintf("b %03d", 99-i), fmt.Sprintf("a %03d", 99-i))
+	}
+	sortLines(t, lines, opts)
+
+	for i := range 100 {
+		if want := fmt.Sprintf("a %03d", 99-i); lines[i] != want {
+			t.Fatalf("stable sort mismatch at %d: got %q, want %q", i, lines[i], want)
+		}
+		if want := fmt.Sprintf("b %03d", 99-i); lines[100+i] != want {
+			t.Fatalf("stable sort mismatch at %d: got %q, want %q", 100+i, lines[100+i], want)
+		}
+	}
+}
+
+// TestSortWithSeparator проверяет сортировку по колонке с разделителем -t
+func TestSortWithSeparator(t *testing.T) {
+	var opts Options
+	opts.Separator = ","
+	opts.Keys = mustKeys(t, "2,2n")
+
+	lines := []string{"pear,10", "apple,9", "fig,100"}
+
+	sort.Slice(lines, lessSort(t, lines, opts))
+
+	want := []string{"apple,9", "pear,10", "fig,100"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("sort with -t mismatch: got %v, want %v", lines, want)
+	}
+}
+
+// TestSortMultipleKeys проверяет сортировку по нескольким ключам с собственными модификаторами
+func TestSortMultipleKeys(t *testing.T) {
+	var opts Options
+	opts.Keys = mustKeys(t, "3n,3", "1,1r")
+
+	lines := []string{
+		"a\tx\t10",
+		"b\ty\t2",
+		"c\tz\t10",
+		"d\tw\t2",
+	}
+
+	sort.Slice(lines, lessSort(t, lines, opts))
+
+	want := []string{
+		"d\tw\t2",
+		"b\ty\t2",
+		"c\tz\t10",
+		"a\tx\t10",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("multi-key sort mismatch: got %v, want %v", lines, want)
+	}
+}
+
+// TestSortKeyOverridesGlobal проверяет, что модификаторы ключа отменяют глобальные флаги
+func TestSortKeyOverridesGlobal(t *testing.T) {
+	var opts Options
+	opts.Reverse = true
+	opts.Keys = mustKeys(t, "1,1n", "2,2")
+
+	lines := []string{"2\ta", "10\tb", "2\tc"}
+
+	sort.Slice(lines, lessSort(t, lines, opts))
+
+	// первый ключ числовой без r, второй наследует глобальный -r
+	want := []string{"2\tc", "2\ta", "10\tb"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("key override mismatch: got %v, want %v", lines, want)
+	}
+}
+
+// TestParseHuman проверяет функцию parseHuman
+func TestParseHuman(t *testing.T) {
+	const (
+		ki = 1024.0
+		mi = ki * 1024
+		gi = mi * 1024
+		ti = gi * 1024
+	)
+	tests := []struct {
+		in     string
+		want   float64
+		wantOK bool
+	}{
+		{"", 0, false},
+		{"abc", 0, false},
+		{"-", 0, false},
+		{"K", 0, false},
+		{"10", 10, true},
+		{"1K", ki, true},
+		{"2M", 2 * mi, true},
+		{"3G", 3 * gi, true},
+		{"5k", 5 * ki, true},
+		{"7m", 7 * mi, true},
+		{"2T", 2 * ti, true},
+		{"1P", ti * ki, true},
+		{"1E", ti * mi, true},
+		{"1.5G", 1.5 * gi, true},
+		{"1.5Gi", 1.5 * gi, true},
+		{"4KiB", 4 * ki, true},
+		{"4KB", 4000, true},
+		{"4kB", 4000, true},
+		{"3MB", 3e6, true},
+		{"1TB", 1e12, true},
+		{"512B", 512, true},
+		{"-2M", -2 * mi, true},
+		{"+1K", ki, true},
+		{".5K", 512, true},
+		{"  10K", 10 * ki, true},
+		{"1.5G\t/var/log", 1.5 * gi, true},
+		{"1e3", 1, true}, // экспонента не поддерживается, e - не суффикс
+	}
+
+	for _, tt := range tests {
+		got, ok := parseHuman(tt.in)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseHuman(%q) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+// TestSortHumanSuffixes проверяет -h с суффиксами SI и IEC, отрицательными
+// и нераспознанными значениями
+func TestSortHumanSuffixes(t *testing.T) {
+	var opts Options
+	opts.Human = true
+
+	lines := []string{"1.5Gi", "2TB", "-1K", "n/a", "999MB", "1G", "unknown", "1000KB", "0", "1MiB", "-"}
+	sortLines(t, lines, opts)
+
+	want := []string{"-", "n/a", "unknown", "-1K", "0", "1000KB", "1MiB", "999MB", "1G", "1.5Gi", "2TB"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("human sort mismatch: got %v, want %v", lines, want)
+	}
+}
+
+// TestLessSortNumeric проверяет функцию lessSort с флагом -n
+func TestLessSortNumeric(t *testing.T) {
+	var opts Options
+	opts.Numeric = true
+
+	lines := []string{"10", "2", "30"}
+
+	sort.Slice(lines, lessSort(t, lines, opts))
+
+	want := []string{"2", "10", "30"}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("numeric sort mismatch: got %v, want %v", lines, want)
+			break
+		}
+	}
+}
+
+// TestLessSortReverse проверяет функцию lessSort с флагом -r
+func TestLessSortReverse(t *testing.T) {
+	var opts Options
+	opts.Reverse = true
+
+	lines := []string{"a", "c", "b"}
+
+	sort.Slice(lines, lessSort(t, lines, opts))
+
+	want := []string{"c", "b", "a"}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("reverse sort mismatch: got %v, want %v", lines, want)
+			break
+		}
+	}
+}
+
+// TestLessSortReverse проверяет функцию lessSort с флагом -M
+func TestLessSortMonth(t *testing.T) {
+	var opts Options
+	opts.Month = true
+
+	// последнее значение ("Feb ") с дополнительным пробелом, должно идти после значения без пробела
+	lines := []string{"Mar", "Feb", "Jan", "Feb "}
+
+	sort.Slice(lines, lessSort(t, lines, opts))
+
+	want := []string{"Jan", "Feb", "Feb ", "Mar"}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("month sort mismatch: got %v, want %v", lines, want)
+			break
+		}
+	}
+}
+
+// TestLessSortReverse проверяет функцию lessSort с флагом -h
+func TestLessSortHuman(t *testing.T) {
+	var opts Options
+	opts.Human = true
+
+	lines := []string{"2K", "1M", "2048", "512"}
+
+	sort.Slice(lines, lessSort(t, lines, opts))
+
+	want := []string{"512", "2048", "2K", "1M"}
+
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("human sort mismatch: got %v, want %v", lines, want)
+			break
+		}
+	}
+}
+
+// TestCheckSorted_StringSorted проверяет отсортированные строки с флагом -c
+func TestCheckSorted_StringSorted(t *testing.T) {
+	var opts Options
+	lines := []string{"a", "b", "c"}
+	if err := checkSorted(t, lines, opts); err != nil {
+		t.Errorf("expected sorted, got error %v", err)
+	}
+}
+
+// TestCheckSorted_StringSorted проверяет НЕ отсортированные строки с флагом -c
+func TestCheckSorted_StringUnsorted(t *testing.T) {
+	var opts Options
+	lines := []string{"b", "a"}
+	if err := checkSorted(t, lines, opts); err == nil {
+		t.Errorf("expected error for unsorted input")
+	}
+}
+
+// TestCheckSorted_StringSorted проверяет отсортированные строки с флагом -cn
+func TestCheckSorted_Numeric(t *testing.T) {
+	var opts Options
+	opts.Numeric = true
+	lines := []string{"1", "2", "10"}
+	if err := checkSorted(t, lines, opts); err != nil {
+		t.Errorf("expected sorted numbers, got error %v", err)
+	}
+}
+
+// TestCheckSorted_StringSorted проверяет НЕ отсортированные строки с флагом -cn
+func TestCheckSorted_NumericUnsorted(t *testing.T) {
+	var opts Options
+	opts.Numeric = true
+	lines := []string{"10", "2", "1"}
+	if err := checkSorted(t, lines, opts); err == nil {
+		t.Errorf("expected error for unsorted numeric input")
+	}
+}
+
+// TestCheckSorted_StringSorted проверяет отсортированные строки с флагом -cM
+func TestCheckSorted_Months(t *testing.T) {
+	var opts Options
+	opts.Month = true
+	lines := []string{"Jan", "Feb", "Mar"}
+	if err := checkSorted(t, lines, opts); err != nil {
+		t.Errorf("expected sorted months, got error %v", err)
+	}
+}
+
+// TestCheckSorted_StringSorted проверяет НЕ отсортированные строки с флагом -cM
+func TestCheckSorted_MonthsUnsorted(t *testing.T) {
+	var opts Options
+	opts.Month = true
+	lines := []string{"Mar", "Jan"}
+	if err := checkSorted(t, lines, opts); err == nil {
+		t.Errorf("expected error for unsorted months")
+	}
+}
+
+// TestCheckSorted_StringSorted проверяет отсортированные строки с флагом -ch
+func TestCheckSorted_HumanReadable(t *testing.T) {
+	var opts Options
+	opts.Human = true
+	lines := []string{"1K", "2K", "10M"}
+	if err := checkSorted(t, lines, opts); err != nil {
+		t.Errorf("expected sorted human-readable, got error %v", err)
+	}
+}
+
+// TestCheckSorted_StringSorted проверяет НЕ отсортированные строки с флагом -ch
+func TestCheckSorted_HumanReadableUnsorted(t *testing.T) {
+	var opts Options
+	opts.Human = true
+	lines := []string{"10M", "2K"}
+	if err := checkSorted(t, lines, opts); err == nil {
+		t.Errorf("expected error for unsorted human-readable numbers")
+	}
+}
+
+// TestCheckSorted_StringSorted проверяет НЕ отсортированные строки с флагом -cr
+func TestCheckSorted_Reverse(t *testing.T) {
+	var opts Options
+	opts.Reverse = true
+	lines := []string{"c", "b", "a"}
+	if err := checkSorted(t, lines, opts); err != nil {
+		t.Errorf("expected sorted in reverse, got error %v", err)
+	}
+}
+
+// TestSortByColumn проверяет сортировку по колонке с флагом -k 1
+func TestSortByColumn(t *testing.T) {
+	var opts Options
+	lines := []string{
+		"3\tapple",
+		"1\tpear",
+		"2\tbanana",
+	}
+
+	opts.Keys = mustKeys(t, "1,1")
+	opts.Numeric = true
+	sort.Slice(lines, lessSort(t, lines, opts))
+
+	want := []string{
+		"1\tpear",
+		"2\tbanana",
+		"3\tapple",
+	}
+
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("sort by col=1 numeric failed: got %v, want %v", lines, want)
+			break
+		}
+	}
+}
+
+// TestSortByColumn проверяет сортировку по колонке с флагом -k 2
+func TestSortBySecondColumn(t *testing.T) {
+	var opts Options
+	lines := []string{
+		"1\tpear",
+		"2\tbanana",
+		"3\tapple",
+	}
+
+	opts.Keys = mustKeys(t, "2,2")
+	opts.Numeric = false
+	sort.Slice(lines, lessSort(t, lines, opts))
+
+	want := []string{
+		"3\tapple",
+		"2\tbanana",
+		"1\tpear",
+	}
+
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("sort by col=2 alpha failed: got %v, want %v", lines, want)
+			break
+		}
+	}
+}
+
+// TestSortByColumn проверяет сортировку по колонке с флагом -r -k 1
+func TestSortBySecondColumnReverse(t *testing.T) {
+	var opts Options
+	lines := []string{
+		"1\tpear",
+		"2\tbanana",
+		"3\tapple",
+	}
+
+	opts.Keys = mustKeys(t, "2,2")
+	opts.Reverse = true
+	sort.Slice(lines, lessSort(t, lines, opts))
+
+	want := []string{
+		"1\tpear",
+		"2\tbanana",
+		"3\tapple",
+	}
+
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("sort by col=2 reverse failed: got %v, want %v", lines, want)
+			break
+		}
+	}
+}
+
+// TestSortNumericKeyPrefix проверяет, что -n берет число в начале ключа,
+// а текст и поля после него не мешают сравнению
+func TestSortNumericKeyPrefix(t *testing.T) {
+	tests := []struct {
+		keys  []string
+		lines []string
+		want  []string
+	}{
+		{
+			keys:  []string{"2"},
+			lines: []string{"a\t10\tx", "b\t9\ty", "c\t100\tz"},
+			want:  []string{"b\t9\ty", "a\t10\tx", "c\t100\tz"},
+		},
+		{
+			keys:  []string{"2"},
+			lines: []string{"a -1.5 x", "b +2 y", "c .5 z", "d x 1"},
+			want:  []string{"a -1.5 x", "d x 1", "c .5 z", "b +2 y"},
+		},
+		{
+			lines: []string{"10 x", "9 y", "1e3 z"},
+			want:  []string{"1e3 z", "9 y", "10 x"},
+		},
+	}
+
+	for _, tt := range tests {
+		var opts Options
+		opts.Numeric = true
+		opts.Stable = true
+		opts.Keys = mustKeys(t, tt.keys...)
+		lines := slices.Clone(tt.lines)
+		sortLines(t, lines, opts)
+		if !slices.Equal(lines, tt.want) {
+			t.Errorf("sort -n -k %v %q = %q, want %q", tt.keys, tt.lines, lines, tt.want)
+		}
+	}
+}
+
+// TestParseBufferSize проверяет разбор размера буфера для -S
+func TestParseBufferSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"10", 10 * 1024, false},
+		{"100b", 100, false},
+		{"2K", 2 * 1024, false},
+		{"3M", 3 * 1024 * 1024, false},
+		{"1G", 1024 * 1024 * 1024, false},
+		{"abc", 0, true},
+		{"0", 0, true},
+		{"-5M", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseBufferSize(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseBufferSize(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseBufferSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+// externalSortLines сортирует lines через Sorter с буфером limit байт
+func externalSortLines(t *testing.T, lines []string, opts Options, limit int64) ([]string, int) {
+	t.Helper()
+
+	opts.BufferSize = limit
+	opts.TempDir = t.TempDir()
+	s, err := NewSorter(opts)
+	if err != nil {
+		t.Fatalf("NewSorter: %v", err)
+	}
+	defer s.Close()
+
+	for _, l := range lines {
+		if err := s.Add(l); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	runs := len(s.runs)
+
+	var buf bytes.Buffer
+	if err := s.WriteSorted(&buf); err != nil {
+		t.Fatalf("WriteSorted: %v", err)
+	}
+	if len(s.runs) > runs {
+		runs = len(s.runs)
+	}
+
+	out := strings.TrimSuffix(buf.String(), "\n")
+	if out == "" {
+		return nil, runs
+	}
+	return strings.Split(out, "\n"), runs
+}
+
+// TestExternalSortMatchesInMemory проверяет, что сортировка со сбросом на диск
+// дает тот же результат, что и сортировка в памяти
+func TestExternalSortMatchesInMemory(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		setup func(o *Options)
+	}{
+		{"basic", []string{"pear", "apple", "fig", "banana", "kiwi", "cherry", "date"}, func(o *Options) {}},
+		{"numeric", []string{"10", "2", "33", "1", "100", "7", "21"}, func(o *Options) { o.Numeric = true }},
+		{"reverse", []string{"b", "d", "a", "c", "f", "e"}, func(o *Options) { o.Reverse = true }},
+		{"months", []string{"Mar", "Jan", "Dec", "Feb", "Jul", "Apr"}, func(o *Options) { o.Month = true }},
+		{"human", []string{"2K", "1M", "2048", "512", "3G", "10K"}, func(o *Options) { o.Human = true }},
+		{"column", []string{"1\tpear", "2\tbanana", "3\tapple", "4\tfig"}, func(o *Options) { o.Keys = []Key{{StartField: 2, StartChar: 1, EndField: 2}} }},
+		{"unique", []string{"b", "a", "b", "c", "a", "c", "b"}, func(o *Options) { o.Unique = true }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts Options
+			tt.setup(&opts)
+
+			want, _ := externalSortLines(t, tt.lines, opts, 0)
+			got, runs := externalSortLines(t, tt.lines, opts, 8)
+
+			if runs < 2 {
+				t.Fatalf("expected several runs on disk, got %d", runs)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("external sort mismatch: got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// TestExternalSortCleanup проверяет удаление временных файлов
+func TestExternalSortCleanup(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSorter(Options{BufferSize: 4, TempDir: dir})
+	if err != nil {
+		t.Fatalf("NewSorter: %v", err)
+	}
+	for _, l := range []string{"c", "b", "a", "d"} {
+		if err := s.Add(l); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	if err := s.WriteSorted(io.Discard); err != nil {
+		t.Fatalf("WriteSorted: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected temp dir to be empty, got %d files", len(entries))
+	}
+}
+
+// TestExternalSortBatches проверяет многопроходное слияние, когда runs больше BatchSize:
+// результат и порядок равных ключей как в памяти, временные файлы удаляются
+func TestExternalSortBatches(t *testing.T) {
+	lines := generateLines(500)
+	opts := Options{Stable: true, Keys: []Key{{StartField: 1, EndField: 1, Options: KeyOptions{Numeric: true}, HasOptions: true}}}
+	want := slices.Clone(lines)
+	sortLines(t, want, opts)
+
+	dir := t.TempDir()
+	opts.BufferSize = 256
+	opts.TempDir = dir
+	opts.BatchSize = 3
+	s, err := NewSorter(opts)
+	if err != nil {
+		t.Fatalf("NewSorter: %v", err)
+	}
+	for _, l := range lines {
+		if err := s.Add(l); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	if len(s.runs) <= 3*opts.BatchSize {
+		t.Fatalf("expected more than %d runs, got %d", 3*opts.BatchSize, len(s.runs))
+	}
+
+	var buf bytes.Buffer
+	if err := s.WriteSorted(&buf); err != nil {
+		t.Fatalf("WriteSorted: %v", err)
+	}
+	if len(s.runs) > opts.BatchSize {
+		t.Errorf("final merge read %d runs, want at most %d", len(s.runs), opts.BatchSize)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if got := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("batched external sort differs from in-memory sort")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected temp dir to be empty, got %d files", len(entries))
+	}
+}
+
+// generateLines создает n строк вида "<число>\t<слово>" с повторами ключей
+func generateLines(n int) []string {
+	rng := rand.New(rand.NewPCG(1, 2))
+	words := []string{"apple", "banana", "cherry", "date", "fig", "grape", "kiwi", "lemon"}
+	months := []string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+	sizes := []string{"", "K", "M", "G"}
+
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("%d\t%s\t%s\t%d%s",
+			rng.IntN(n/4+1),
+			words[rng.IntN(len(words))],
+			months[rng.IntN(len(months))],
+			rng.IntN(1000),
+			sizes[rng.IntN(len(sizes))],
+		)
+	}
+	return lines
+}
+
+// TestParallelSortMatchesSequential проверяет, что --parallel дает тот же результат,
+// что и сортировка в одной горутине
+func TestParallelSortMatchesSequential(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, o *Options)
+	}{
+		{"basic", func(t *testing.T, o *Options) {}},
+		{"numeric", func(t *testing.T, o *Options) { o.Numeric = true }},
+		{"reverse", func(t *testing.T, o *Options) { o.Reverse = true }},
+		{"keys", func(t *testing.T, o *Options) { o.Keys = mustKeys(t, "2,2", "1,1nr") }},
+		{"months", func(t *testing.T, o *Options) { o.Keys = mustKeys(t, "3,3M") }},
+		{"human", func(t *testing.T, o *Options) { o.Keys = mustKeys(t, "4,4h") }},
+		{"stable", func(t *testing.T, o *Options) { o.Stable = true; o.Keys = mustKeys(t, "2,2") }},
+	}
+
+	input := generateLines(10000)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts Options
+			tt.setup(t, &opts)
+
+			want := slices.Clone(input)
+			sortLines(t, want, opts)
+
+			for _, workers := range []int{2, 3, 8} {
+				opts.Parallel = workers
+				got := slices.Clone(input)
+				sortLines(t, got, opts)
+				if !slices.Equal(got, want) {
+					t.Errorf("--parallel=%d output differs from sequential sort", workers)
+				}
+			}
+		})
+	}
+}
+
+// TestParallelSortSmallInput проверяет маленькие входы, которые не делятся на части
+func TestParallelSortSmallInput(t *testing.T) {
+	var opts Options
+	opts.Parallel = 4
+
+	for _, lines := range [][]string{nil, {"a"}, {"b", "a"}} {
+		got := slices.Clone(lines)
+		sortLines(t, got, opts)
+		want := slices.Clone(lines)
+		slices.Sort(want)
+		if !slices.Equal(got, want) {
+			t.Errorf("parallel sort of %v = %v, want %v", lines, got, want)
+		}
+	}
+}
+
+// benchmarkSort сортирует сгенерированные строки с заданным --parallel
+func benchmarkSort(b *testing.B, workers int) {
+	var opts Options
+	opts.Keys = mustKeys(b, "2,2", "1,1n")
+	opts.Parallel = workers
+
+	input := generateLines(100000)
+	lines := make([]string, len(input))
+
+	b.ResetTimer()
+	for range b.N {
+		copy(lines, input)
+		sortLines(b, lines, opts)
+	}
+}
+
+func BenchmarkSortSequential(b *testing.B) { benchmarkSort(b, 1) }
+
+func BenchmarkSortParallel(b *testing.B) { benchmarkSort(b, runtime.NumCPU()) }
+
+// benchmarkKeyMode сравнивает разбор ключей при каждом сравнении (reparse)
+// с однократным разбором перед сортировкой (decorated)
+func benchmarkKeyMode(b *testing.B, spec string) {
+	var opts Options
+	opts.Keys = mustKeys(b, spec)
+	input := generateLines(20000)
+	lines := make([]string, len(input))
+
+	b.Run("reparse", func(b *testing.B) {
+		for range b.N {
+			copy(lines, input)
+			sort.Slice(lines, lessSort(b, lines, opts))
+		}
+	})
+	b.Run("decorated", func(b *testing.B) {
+		for range b.N {
+			copy(lines, input)
+			sortLines(b, lines, opts)
+		}
+	})
+}
+
+func BenchmarkKeyNumeric(b *testing.B) { benchmarkKeyMode(b, "1,1n") }
+
+func BenchmarkKeyHuman(b *testing.B) { benchmarkKeyMode(b, "4,4h") }
+
+func BenchmarkKeyMonth(b *testing.B) { benchmarkKeyMode(b, "3,3M") }
+
+// TestCompareVersion проверяет сравнение номеров версий (-V)
+func TestCompareVersion(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.9", "1.10", -1},
+		{"v1.10.2", "v1.9.0", 1},
+		{"v1.9.0-rc1", "v1.9.0", -1},
+		{"v1.9.0-rc1", "v1.9.0-rc2", -1},
+		{"v1.9.0-rc2", "v1.9.0-rc10", -1},
+		{"1.0~beta", "1.0", -1},
+		{"1.9.0", "1.9.0.1", -1},
+		{"1.9.0-rc1", "1.9.0.1", -1},
+		{"1.01", "1.1", 0},
+		{"file2.txt", "file10.txt", -1},
+		{"a", "a", 0},
+		{"", "1", -1},
+		{"1a", "1.", -1}, // буквы раньше остальных символов
+	}
+
+	for _, tt := range tests {
+		if got := compareVersion(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersion(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := compareVersion(tt.b, tt.a); got != -tt.want {
+			t.Errorf("compareVersion(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+// TestParseGeneral проверяет разбор чисел для -g
+func TestParseGeneral(t *testing.T) {
+	tests := []struct {
+		in        string
+		want      float64
+		wantClass int
+	}{
+		{"1e3", 1000, 2},
+		{"  -2.5E-1", -0.25, 2},
+		{"inf", math.Inf(1), 2},
+		{"-Infinity", math.Inf(-1), 2},
+		{"NaN", 0, 1},
+		{"12abc", 12, 2},
+		{"0x1p4", 16, 2},
+		{"1e999", math.Inf(1), 2},
+		{"abc", 0, 0},
+		{"", 0, 0},
+	}
+
+	for _, tt := range tests {
+		got, class := parseGeneral(tt.in)
+		if got != tt.want || class != tt.wantClass {
+			t.Errorf("parseGeneral(%q) = %v, %d, want %v, %d", tt.in, got, class, tt.want, tt.wantClass)
+		}
+	}
+}
+
+// TestSortVersion проверяет сортировку с флагом -V
+func TestSortVersion(t *testing.T) {
+	var opts Options
+	opts.Version = true
+
+	lines := []string{"v1.10.2", "v1.9.0", "v1.9.0-rc1", "v1.2.10", "v1.2.9", "v2.0.0-beta"}
+	sortLines(t, lines, opts)
+
+	want := []string{"v1.2.9", "v1.2.10", "v1.9.0-rc1", "v1.9.0", "v1.10.2", "v2.0.0-beta"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("version sort mismatch: got %v, want %v", lines, want)
+	}
+}
+
+// TestSortGeneralNumeric проверяет сортировку с флагом -g
+func TestSortGeneralNumeric(t *testing.T) {
+	var opts Options
+	opts.General = true
+
+	lines := []string{"1e3", "inf", "-inf", "NaN", "abc", "2.5", "-1e-2", "100"}
+	sortLines(t, lines, opts)
+
+	want := []string{"abc", "NaN", "-inf", "-1e-2", "2.5", "100", "1e3", "inf"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("general numeric sort mismatch: got %v, want %v", lines, want)
+	}
+}
+
+// TestSortVersionKey проверяет модификатор V у ключа
+func TestSortVersionKey(t *testing.T) {
+	var opts Options
+	opts.Keys = mustKeys(t, "2,2V")
+
+	lines := []string{"b 1.10", "a 1.9", "c 1.9-rc1"}
+	sortLines(t, lines, opts)
+
+	want := []string{"c 1.9-rc1", "a 1.9", "b 1.10"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("version key sort mismatch: got %v, want %v", lines, want)
+	}
+}
+
+// TestSortFoldCase проверяет сортировку без учета регистра (-f)
+func TestSortFoldCase(t *testing.T) {
+	var opts Options
+	opts.FoldCase = true
+
+	lines := []string{"banana", "Cherry", "apple", "Банан", "арбуз", "Apple"}
+	sortLines(t, lines, opts)
+
+	// при равенстве без учета регистра строки сравниваются целиком
+	want := []string{"Apple", "apple", "banana", "Cherry", "арбуз", "Банан"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("fold case sort mismatch: got %v, want %v", lines, want)
+	}
+}
+
+// TestSortDictionary проверяет сортировку только по буквам, цифрам и пробелам (-d)
+func TestSortDictionary(t *testing.T) {
+	var opts Options
+	opts.Dictionary = true
+
+	lines := []string{"#c", "b-", "_a", "(d)"}
+	sortLines(t, lines, opts)
+
+	want := []string{"_a", "b-", "#c", "(d)"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("dictionary sort mismatch: got %v, want %v", lines, want)
+	}
+}
+
+// TestSortLocale проверяет сортировку с Unicode collation (--locale)
+func TestSortLocale(t *testing.T) {
+	tests := []struct {
+		name   string
+		locale string
+		setup  func(t *testing.T, o *Options)
+		lines  []string
+		want   []string
+	}{
+		{
+			name:   "ru",
+			locale: "ru",
+			setup:  func(t *testing.T, o *Options) {},
+			lines:  []string{"яблоко", "ёж", "Ель", "жук", "ель"},
+			want:   []string{"ёж", "ель", "Ель", "жук", "яблоко"},
+		},
+		{
+			name:   "en",
+			locale: "en",
+			setup:  func(t *testing.T, o *Options) {},
+			lines:  []string{"cherry", "Banana", "apple", "Apple"},
+			want:   []string{"apple", "Apple", "Banana", "cherry"},
+		},
+		{
+			name:   "reverse",
+			locale: "ru",
+			setup:  func(t *testing.T, o *Options) { o.Reverse = true },
+			lines:  []string{"ёж", "яблоко", "жук"},
+			want:   []string{"яблоко", "жук", "ёж"},
+		},
+		{
+			name:   "key",
+			locale: "ru",
+			setup:  func(t *testing.T, o *Options) { o.Keys = mustKeys(t, "2,2") },
+			lines:  []string{"1 ёж", "2 жук", "3 еж"},
+			want:   []string{"3 еж", "1 ёж", "2 жук"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts Options
+			opts.Locale = tt.locale
+			tt.setup(t, &opts)
+
+			lines := slices.Clone(tt.lines)
+			sortLines(t, lines, opts)
+			if !reflect.DeepEqual(lines, tt.want) {
+				t.Errorf("locale sort mismatch: got %v, want %v", lines, tt.want)
+			}
+		})
+	}
+}
+
+// TestMergeReaders проверяет слияние уже отсортированных потоков (-m)
+func TestMergeReaders(t *testing.T) {
+	var opts Options
+	opts.Numeric = true
+
+	readers := []io.Reader{
+		strings.NewReader("1\n5\n10\n"),
+		strings.NewReader("2\n5\n"),
+		strings.NewReader(""),
+		strings.NewReader("3\n4\n100"),
+	}
+
+	var buf bytes.Buffer
+	if err := Merge(readers, &buf, opts); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+
+	want := "1\n2\n3\n4\n5\n5\n10\n100\n"
+	if buf.String() != want {
+		t.Errorf("merge mismatch: got %q, want %q", buf.String(), want)
+	}
+}
+
+// TestMergeFilesBatches проверяет -m для файлов, которых больше BatchSize:
+// результат как у Merge, с заголовками и -u, временные файлы удаляются
+func TestMergeFilesBatches(t *testing.T) {
+	dir := t.TempDir()
+	var names []string
+	var readers []io.Reader
+	for i := range 20 {
+		var sb strings.Builder
+		sb.WriteString("n\n")
+		for v := i; v < 200; v += 7 {
+			fmt.Fprintf(&sb, "%d\n", v)
+		}
+		name := filepath.Join(dir, fmt.Sprintf("in%02d.txt", i))
+		if err := os.WriteFile(name, []byte(sb.String()), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+		readers = append(readers, strings.NewReader(sb.String()))
+	}
+
+	opts := Options{Header: true, Unique: true, BatchSize: 3, TempDir: t.TempDir()}
+	opts.Numeric = true
+
+	var want, got bytes.Buffer
+	if err := Merge(readers, &want, opts); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	if err := MergeFiles(names, &got, opts); err != nil {
+		t.Fatalf("MergeFiles: %v", err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("batched merge mismatch: got %q, want %q", got.String(), want.String())
+	}
+	if !strings.HasPrefix(got.String(), "n\n0\n1\n2\n") {
+		t.Errorf("unexpected merge result start: %q", got.String()[:20])
+	}
+	if entries, _ := os.ReadDir(opts.TempDir); len(entries) != 0 {
+		t.Errorf("expected temp dir to be empty, got %d files", len(entries))
+	}
+
+	if err := MergeFiles([]string{filepath.Join(dir, "missing")}, io.Discard, opts); err == nil {
+		t.Error("expected error for missing input")
+	}
+}
+
+// TestMergeReadersUnique проверяет слияние с -u
+func TestMergeReadersUnique(t *testing.T) {
+	var opts Options
+	opts.Unique = true
+
+	readers := []io.Reader{
+		strings.NewReader("a\nb\nc\n"),
+		strings.NewReader("a\nc\nd\n"),
+	}
+
+	var buf bytes.Buffer
+	if err := Merge(readers, &buf, opts); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+
+	if want := "a\nb\nc\nd\n"; buf.String() != want {
+		t.Errorf("unique merge mismatch: got %q, want %q", buf.String(), want)
+	}
+}
+
+// TestCheckSorted_Disorder проверяет сообщение о первом нарушении порядка
+func TestCheckSorted_Disorder(t *testing.T) {
+	var opts Options
+	lines := []string{"a", "c", "b", "a"}
+
+	err := checkSorted(t, lines, opts)
+	var disorder *DisorderError
+	if !errors.As(err, &disorder) {
+		t.Fatalf("expected DisorderError, got %v", err)
+	}
+	if want := "-:3: disorder: b"; err.Error() != want {
+		t.Errorf("error = %q, want %q", err.Error(), want)
+	}
+}
+
+// TestCheckSorted_Unique проверяет, что -c -u считает повтор ключа нарушением порядка
+func TestCheckSorted_Unique(t *testing.T) {
+	var opts Options
+	lines := []string{"a", "b", "b", "c"}
+
+	if err := checkSorted(t, lines, opts); err != nil {
+		t.Errorf("expected sorted without -u, got error %v", err)
+	}
+
+	opts.Unique = true
+	err := checkSorted(t, lines, opts)
+	if err == nil || err.Error() != "-:3: disorder: b" {
+		t.Errorf("expected duplicate disorder at line 3, got %v", err)
+	}
+}
+
+// TestCheckSorted_UniqueKeys проверяет, что -c -u сравнивает только ключи
+func TestCheckSorted_UniqueKeys(t *testing.T) {
+	var opts Options
+	opts.Unique = true
+	opts.Keys = mustKeys(t, "1,1")
+	lines := []string{"a 1", "b 2", "b 1"}
+
+	err := checkSorted(t, lines, opts)
+	if err == nil || err.Error() != "-:3: disorder: b 1" {
+		t.Errorf("expected key duplicate disorder at line 3, got %v", err)
+	}
+}
+
+// sortOutput сортирует lines через Sort в памяти и возвращает вывод
+func sortOutput(t *testing.T, lines []string, opts Options) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Sort(strings.NewReader(strings.Join(lines, "\n")), &buf, opts); err != nil {
+		t.Fatalf("Sort: %v", err)
+	}
+	return buf.String()
+}
+
+// TestUniqueByKey проверяет, что -u сравнивает строки по ключу и оставляет первую строку группы
+func TestUniqueByKey(t *testing.T) {
+	var opts Options
+	opts.Unique = true
+	opts.Keys = mustKeys(t, "2,2")
+
+	lines := []string{"z a", "y b", "x a", "w b", "v c"}
+
+	want := "z a\ny b\nv c\n"
+	if got := sortOutput(t, lines, opts); got != want {
+		t.Errorf("unique by key mismatch: got %q, want %q", got, want)
+	}
+
+	// первая строка группы сохраняется и при сортировке со сбросом на диск
+	got, _ := externalSortLines(t, lines, opts, 4)
+	if want := []string{"z a", "y b", "v c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("external unique by key mismatch: got %v, want %v", got, want)
+	}
+}
+
+// TestUniqueNumeric проверяет -u с числовым сравнением (1 == 1.0)
+func TestUniqueNumeric(t *testing.T) {
+	var opts Options
+	opts.Unique = true
+	opts.Numeric = true
+
+	want := "1.0\n2\n10\n"
+	if got := sortOutput(t, []string{"10", "1.0", "2", "1", "2.00"}, opts); got != want {
+		t.Errorf("numeric unique mismatch: got %q, want %q", got, want)
+	}
+
+	// текст после числа не входит в значение: строки с разными числами не склеиваются
+	lines := []string{"3 a", "1 b", "2 c", "3 a", "2 d"}
+	want = "1 b\n2 c\n3 a\n"
+	if got := sortOutput(t, lines, opts); got != want {
+		t.Errorf("numeric unique with text mismatch: got %q, want %q", got, want)
+	}
+	got, _ := externalSortLines(t, lines, opts, 4)
+	if want := []string{"1 b", "2 c", "3 a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("external numeric unique with text mismatch: got %v, want %v", got, want)
+	}
+}
+
+// TestUniqueCount проверяет --count
+func TestUniqueCount(t *testing.T) {
+	var opts Options
+	opts.Count = true
+	opts.Keys = mustKeys(t, "1,1")
+
+	lines := []string{"b 1", "a 1", "b 2", "c 1", "b 3"}
+
+	want := "      1 a 1\n      3 b 1\n      1 c 1\n"
+	if got := sortOutput(t, lines, opts); got != want {
+		t.Errorf("count mismatch: got %q, want %q", got, want)
+	}
+}
+
+// TestSortZeroTerminated проверяет -z: строки разделяются NUL и могут содержать перевод строки
+func TestSortZeroTerminated(t *testing.T) {
+	var opts Options
+	opts.ZeroTerminated = true
+
+	input := "b\x00c\nsecond line\x00a"
+	want := "a\x00b\x00c\nsecond line\x00"
+
+	var buf bytes.Buffer
+	if err := Sort(strings.NewReader(input), &buf, opts); err != nil {
+		t.Fatalf("Sort: %v", err)
+	}
+	if buf.String() != want {
+		t.Errorf("-z sort mismatch: got %q, want %q", buf.String(), want)
+	}
+
+	// со сбросом на диск и слиянием runs
+	opts.BufferSize = 4
+	opts.TempDir = t.TempDir()
+	buf.Reset()
+	if err := Sort(strings.NewReader(input), &buf, opts); err != nil {
+		t.Fatalf("external Sort: %v", err)
+	}
+	if buf.String() != want {
+		t.Errorf("external -z sort mismatch: got %q, want %q", buf.String(), want)
+	}
+
+	if err := Check(strings.NewReader(want), "-", opts); err != nil {
+		t.Errorf("Check of sorted -z input: %v", err)
+	}
+}
+
+// TestSortLongLine проверяет строки длиннее буфера bufio.Scanner по умолчанию
+func TestSortLongLine(t *testing.T) {
+	long := strings.Repeat("x", 200*1024)
+	input := long + "\na\n"
+
+	var buf bytes.Buffer
+	if err := Sort(strings.NewReader(input), &buf, Options{}); err != nil {
+		t.Fatalf("Sort: %v", err)
+	}
+	if want := "a\n" + long + "\n"; buf.String() != want {
+		t.Errorf("long line lost: got %d bytes, want %d", buf.Len(), len(want))
+	}
+
+	// та же строка при слиянии (-m)
+	buf.Reset()
+	err := Merge([]io.Reader{strings.NewReader("a\n"), strings.NewReader(long + "\n")}, &buf, Options{})
+	if err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	if want := "a\n" + long + "\n"; buf.String() != want {
+		t.Errorf("long line lost in merge: got %d bytes, want %d", buf.Len(), len(want))
+	}
+}
+
+// TestMaxLineSize проверяет ошибку при строке длиннее MaxLineSize
+func TestMaxLineSize(t *testing.T) {
+	opts := Options{MaxLineSize: 4}
+
+	var buf bytes.Buffer
+	if err := Sort(strings.NewReader("abcd\nab\n"), &buf, opts); err != nil {
+		t.Fatalf("line of exactly MaxLineSize bytes: %v", err)
+	}
+
+	err := Sort(strings.NewReader("ab\nabcde\n"), io.Discard, opts)
+	if !errors.Is(err, ErrLineTooLong) {
+		t.Errorf("expected ErrLineTooLong, got %v", err)
+	}
+
+	err = Merge([]io.Reader{strings.NewReader("abcde\n")}, io.Discard, opts)
+	if !errors.Is(err, ErrLineTooLong) {
+		t.Errorf("expected ErrLineTooLong from Merge, got %v", err)
+	}
+}
+
+// errReader возвращает ошибку после данных
+type errReader struct {
+	data string
+	err  error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// TestSortReadError проверяет, что ошибка чтения не теряется
+func TestSortReadError(t *testing.T) {
+	readErr := errors.New("disk failure")
+
+	err := Sort(&errReader{data: "b\na\n", err: readErr}, io.Discard, Options{})
+	if !errors.Is(err, readErr) {
+		t.Errorf("Sort error = %v, want %v", err, readErr)
+	}
+
+	err = Check(&errReader{data: "a\nb\n", err: readErr}, "-", Options{})
+	if !errors.Is(err, readErr) {
+		t.Errorf("Check error = %v, want %v", err, readErr)
+	}
+}
+
+// TestSortRandom проверяет -R: порядок зависит только от зерна, равные ключи идут подряд
+func TestSortRandom(t *testing.T) {
+	var opts Options
+	opts.Random = true
+	opts.RandomSeed = 42
+
+	var input []string
+	for i := range 50 {
+		input = append(input, fmt.Sprintf("line%02d", i), fmt.Sprintf("line%02d", i))
+	}
+
+	first := slices.Clone(input)
+	sortLines(t, first, opts)
+	second := slices.Clone(input)
+	slices.Reverse(second)
+	sortLines(t, second, opts)
+	if !slices.Equal(first, second) {
+		t.Errorf("same seed gave different orders")
+	}
+
+	sorted := slices.Clone(input)
+	slices.Sort(sorted)
+	if slices.Equal(first, sorted) {
+		t.Errorf("-R output is sorted lexicographically")
+	}
+	for i := 0; i < len(first); i += 2 {
+		if first[i] != first[i+1] {
+			t.Fatalf("equal lines are not adjacent at %d: %q, %q", i, first[i], first[i+1])
+		}
+	}
+
+	opts.RandomSeed = 43
+	other := slices.Clone(input)
+	sortLines(t, other, opts)
+	if slices.Equal(first, other) {
+		t.Errorf("different seeds gave the same order")
+	}
+}
+
+// TestSortRandomKeyUnique проверяет -R по ключу -k вместе с -u
+func TestSortRandomKeyUnique(t *testing.T) {
+	var opts Options
+	opts.RandomSeed = 7
+	opts.Unique = true
+	opts.Keys = mustKeys(t, "1,1R")
+
+	lines := []string{"a 1", "b 1", "a 2", "c 1", "b 2", "a 3"}
+	out := sortOutput(t, lines, opts)
+
+	got := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	slices.Sort(got)
+	// из каждой группы остается первая строка входа
+	if want := []string{"a 1", "b 1", "c 1"}; !slices.Equal(got, want) {
+		t.Errorf("unexpected unique lines: %q", out)
+	}
+
+	// тот же порядок групп при повторном запуске
+	if again := sortOutput(t, lines, opts); again != out {
+		t.Errorf("same seed gave different output: %q, %q", out, again)
+	}
+}
+
+// TestParseFormatKey проверяет разбор ключей -k для CSV и JSON Lines
+func TestParseFormatKey(t *testing.T) {
+	tests := []struct {
+		in      string
+		format  Format
+		want    Key
+		wantErr bool
+	}{
+		{in: "2", format: FormatCSV, want: Key{StartField: 2, StartChar: 1}},
+		{in: "3n", format: FormatCSV, want: Key{StartField: 3, StartChar: 1, Options: KeyOptions{Numeric: true}, HasOptions: true}},
+		{in: "2,2n", format: FormatCSV, want: Key{StartField: 2, StartChar: 1, EndField: 2, Options: KeyOptions{Numeric: true}, HasOptions: true}},
+		{in: "1,2", format: FormatCSV, wantErr: true},
+		{in: "2.3", format: FormatCSV, wantErr: true},
+		{in: "2,2.1", format: FormatCSV, wantErr: true},
+		{in: "age", format: FormatCSV, want: Key{Name: "age"}},
+		{in: "age:nr", format: FormatCSV, want: Key{Name: "age", Options: KeyOptions{Numeric: true, Reverse: true}, HasOptions: true}},
+		{in: "age:x", format: FormatCSV, wantErr: true},
+		{in: ".user.age", format: FormatJSONL, want: Key{Name: ".user.age"}},
+		{in: ".name:f", format: FormatJSONL, want: Key{Name: ".name", Options: KeyOptions{FoldCase: true}, HasOptions: true}},
+		{in: "2", format: FormatJSONL, wantErr: true},
+		{in: "age", format: FormatText, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseFormatKey(tt.in, tt.format)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseFormatKey(%q, %v) error = %v, wantErr %v", tt.in, tt.format, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("ParseFormatKey(%q, %v) = %+v, want %+v", tt.in, tt.format, got, tt.want)
+		}
+	}
+}
+
+// csvInput - CSV с заголовком, запятыми и кавычками внутри полей и полем с переводом строки
+const csvInput = `name,age,city
+"Smith, John",42,"New
+York"
+ann,9,Paris
+"bob ""b""",100,Rome
+`
+
+// TestSortCSV проверяет сортировку CSV по колонкам с сохранением записей как есть
+func TestSortCSV(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		want string
+	}{
+		{"by name", "age:n", "name,age,city\nann,9,Paris\n\"Smith, John\",42,\"New\nYork\"\n\"bob \"\"b\"\"\",100,Rome\n"},
+		{"by index", "3", "name,age,city\n\"Smith, John\",42,\"New\nYork\"\nann,9,Paris\n\"bob \"\"b\"\"\",100,Rome\n"},
+		{"reverse", "name:r", "name,age,city\n\"bob \"\"b\"\"\",100,Rome\nann,9,Paris\n\"Smith, John\",42,\"New\nYork\"\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := ParseFormatKey(tt.key, FormatCSV)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := Options{Format: FormatCSV, Header: true, Keys: []Key{k}}
+
+			var buf bytes.Buffer
+			if err := Sort(strings.NewReader(csvInput), &buf, opts); err != nil {
+				t.Fatalf("Sort: %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("csv sort mismatch:\ngot  %q\nwant %q", buf.String(), tt.want)
+			}
+
+			// со сбросом на диск записи с переводом строки не разрываются
+			opts.BufferSize = 8
+			opts.TempDir = t.TempDir()
+			buf.Reset()
+			if err := Sort(strings.NewReader(csvInput), &buf, opts); err != nil {
+				t.Fatalf("external Sort: %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("external csv sort mismatch:\ngot  %q\nwant %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+// TestSortCSVErrors проверяет ошибки ключей CSV по имени
+func TestSortCSVErrors(t *testing.T) {
+	opts := Options{Format: FormatCSV, Keys: []Key{{Name: "age"}}}
+	if _, err := NewComparator(opts); err == nil {
+		t.Error("expected error for column name without header")
+	}
+
+	opts.Header = true
+	opts.Keys = []Key{{Name: "missing"}}
+	if err := Sort(strings.NewReader(csvInput), io.Discard, opts); err == nil {
+		t.Error("expected error for unknown column")
+	}
+}
+
+// TestMergeCSVHeader проверяет -m и -c для CSV с заголовками
+func TestMergeCSVHeader(t *testing.T) {
+	opts := Options{Format: FormatCSV, Header: true, Keys: []Key{{Name: "n", Options: KeyOptions{Numeric: true}, HasOptions: true}}}
+
+	readers := []io.Reader{
+		strings.NewReader("id,n\na,1\nc,10\n"),
+		strings.NewReader("id,n\nb,2\n"),
+	}
+	var buf bytes.Buffer
+	if err := Merge(readers, &buf, opts); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	want := "id,n\na,1\nb,2\nc,10\n"
+	if buf.String() != want {
+		t.Errorf("csv merge mismatch: got %q, want %q", buf.String(), want)
+	}
+
+	if err := Check(strings.NewReader(want), "-", opts); err != nil {
+		t.Errorf("Check of sorted csv: %v", err)
+	}
+	err := Check(strings.NewReader("id,n\na,10\nb,2\n"), "-", opts)
+	if err == nil || err.Error() != "-:3: disorder: b,2" {
+		t.Errorf("expected disorder at line 3, got %v", err)
+	}
+}
+
+// TestSortJSONL проверяет сортировку JSON Lines по пути с учетом типов значений
+func TestSortJSONL(t *testing.T) {
+	lines := []string{
+		`{"user":{"age":30,"name":"x"}}`,
+		`{"user":{"age":"old"}}`,
+		`{"user":{"age":4}}`,
+		`not json`,
+		`{"user":{"age":null}}`,
+		`{"user":{"age":4.0,"name":"dup"}}`,
+		`{"user":{"age":true}}`,
+		`{"user":{"name":"z"}}`,
+		`{"user":{"age":[1]}}`,
+	}
+
+	k, err := ParseFormatKey(".user.age", FormatJSONL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{Format: FormatJSONL, Keys: []Key{k}, Stable: true}
+	sortLines(t, lines, opts)
+
+	want := []string{
+		`not json`,
+		`{"user":{"name":"z"}}`,
+		`{"user":{"age":null}}`,
+		`{"user":{"age":true}}`,
+		`{"user":{"age":4}}`,
+		`{"user":{"age":4.0,"name":"dup"}}`,
+		`{"user":{"age":30,"name":"x"}}`,
+		`{"user":{"age":"old"}}`,
+		`{"user":{"age":[1]}}`,
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("jsonl sort mismatch:\ngot  %v\nwant %v", lines, want)
+	}
+}
+
+// TestSortJSONLKeyOptions проверяет модификаторы ключей JSON и индексы массивов
+func TestSortJSONLKeyOptions(t *testing.T) {
+	lines := []string{`{"tags":["b","Size 10K"]}`, `{"tags":["a","size 2M"]}`, `{"tags":["c","SIZE 512"]}`}
+
+	k, err := ParseFormatKey(".tags.0:r", FormatJSONL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{Format: FormatJSONL, Keys: []Key{k}}
+	got := slices.Clone(lines)
+	sortLines(t, got, opts)
+	if want := []string{lines[2], lines[0], lines[1]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("jsonl reverse sort mismatch: got %v, want %v", got, want)
+	}
+
+	k, err = ParseFormatKey(".tags.1:f", FormatJSONL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Keys = []Key{k}
+	got = slices.Clone(lines)
+	sortLines(t, got, opts)
+	if want := []string{lines[0], lines[1], lines[2]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("jsonl fold case sort mismatch: got %v, want %v", got, want)
+	}
+}
+
+// TestParseMonth проверяет распознавание месяцев без учета регистра, с ведущими пробелами
+// и полными названиями
+func TestParseMonth(t *testing.T) {
+	table, err := monthTable(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"Jan", 1},
+		{"jan", 1},
+		{"JANUARY", 1},
+		{"  Feb", 2},
+		{"\tsept", 9},
+		{"Dec 25", 12},
+		{"Mar.", 3},
+		{"янв", 1},
+		{"Января", 1},
+		{"  май", 5},
+		{"ДЕКАБРЬ", 12},
+		{"", 0},
+		{"Janu", 0},
+		{"foo", 0},
+		{"1Jan", 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseMonth(tt.in, table); got != tt.want {
+			t.Errorf("parseMonth(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestSortMonthNames проверяет -M со смешанными названиями: неопознанные значения идут перед январем
+func TestSortMonthNames(t *testing.T) {
+	var opts Options
+	opts.Month = true
+
+	lines := []string{"dec", "March", "foo", " feb", "январь", "Jan", "апр", "", "мая"}
+	sortLines(t, lines, opts)
+
+	want := []string{"", "foo", "Jan", "январь", " feb", "March", "апр", "мая", "dec"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("month sort mismatch: got %v, want %v", lines, want)
+	}
+}
+
+// TestSortMonthLocales проверяет выбор языков месяцев и регистрацию нового языка
+func TestSortMonthLocales(t *testing.T) {
+	opts := Options{KeyOptions: KeyOptions{Month: true}, MonthLocales: []string{"en"}}
+
+	// русские названия не опознаны и идут первыми
+	lines := []string{"Feb", "фев", "Jan"}
+	sortLines(t, lines, opts)
+	if want := []string{"фев", "Jan", "Feb"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("en month sort mismatch: got %v, want %v", lines, want)
+	}
+
+	opts.MonthLocales = []string{"xx"}
+	if _, err := NewComparator(opts); err == nil {
+		t.Error("expected error for unknown month locale")
+	}
+
+	RegisterMonths("de", Months{
+		{"januar", "jan"}, {"februar", "feb"}, {"märz", "mär"}, {"april", "apr"},
+		{"mai"}, {"juni", "jun"}, {"juli", "jul"}, {"august", "aug"},
+		{"september", "sep"}, {"oktober", "okt"}, {"november", "nov"}, {"dezember", "dez"},
+	})
+	opts.MonthLocales = []string{"de"}
+	lines = []string{"Dezember", "Mai", "März"}
+	sortLines(t, lines, opts)
+	if want := []string{"März", "Mai", "Dezember"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("de month sort mismatch: got %v, want %v", lines, want)
+	}
+}
+
+// TestSortDebug проверяет разметку ключей и предупреждения о данных с Debug
+func TestSortDebug(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		keys     []string
+		input    string
+		want     string
+		warnings []string
+	}{
+		{
+			name:     "numeric key",
+			keys:     []string{"2,2n"},
+			input:    "a 10\nb x\n",
+			want:     "b x\n  ^ no match for key\n___\na 10\n  __\n____\n",
+			warnings: []string{"key 1: 1 line has no numeric value"},
+		},
+		{
+			name:     "numeric key with text",
+			keys:     []string{"2n"},
+			opts:     Options{Stable: true},
+			input:    "a 10 b\nc x 1\n",
+			want:     "c x 1\n  ^ no match for key\na 10 b\n  __\n",
+			warnings: []string{"key 1: 1 line has no numeric value"},
+		},
+		{
+			name:     "numeric line",
+			opts:     Options{KeyOptions: KeyOptions{General: true}, Stable: true},
+			input:    "x\n1\ny\n",
+			want:     "x\n^ no match for key\ny\n^ no match for key\n1\n_\n",
+			warnings: []string{"2 lines have no numeric value"},
+		},
+		{
+			name:  "whole line",
+			input: "b\na\n",
+			want:  "a\n_\nb\n_\n",
+		},
+		{
+			name:  "tabs and utf8",
+			keys:  []string{"2,2"},
+			opts:  Options{Separator: "\t", Stable: true},
+			input: "ёж\tёлка\n",
+			want:  "ёж>ёлка\n   ____\n",
+		},
+		{
+			name:  "human and month",
+			keys:  []string{"1,1h", "2,2M"},
+			opts:  Options{Stable: true},
+			input: "1.5Gi  jan x\n",
+			want:  "1.5Gi  jan x\n_____\n       ___\n",
+		},
+		{
+			name:  "count",
+			opts:  Options{Count: true},
+			input: "b\nb\n",
+			want:  "      2 b\n        _\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Debug = true
+			opts.Keys = mustKeys(t, tt.keys...)
+			var warnings []string
+			opts.Warn = func(msg string) { warnings = append(warnings, msg) }
+
+			var buf bytes.Buffer
+			if err := Sort(strings.NewReader(tt.input), &buf, opts); err != nil {
+				t.Fatalf("Sort: %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("debug output mismatch:\ngot  %q\nwant %q", buf.String(), tt.want)
+			}
+			if !reflect.DeepEqual(warnings, tt.warnings) {
+				t.Errorf("warnings = %q, want %q", warnings, tt.warnings)
+			}
+		})
+	}
+}
+
+// TestWarnings проверяет предупреждения --debug о подозрительных параметрах
+func TestWarnings(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		keys []string
+		want []string
+	}{
+		{
+			name: "default",
+			want: []string{"text ordering performed using simple byte comparison"},
+		},
+		{
+			name: "locale",
+			opts: Options{Locale: "ru"},
+			want: []string{`text ordering performed using "ru" sorting rules`},
+		},
+		{
+			name: "numeric spans fields",
+			keys: []string{"2n", "3,3n", "1,1", "2b,2"},
+			want: []string{
+				"text ordering performed using simple byte comparison",
+				"key 1 is numeric and spans multiple fields",
+			},
+		},
+		{
+			name: "leading blanks",
+			keys: []string{"2,2"},
+			want: []string{
+				"text ordering performed using simple byte comparison",
+				"leading blanks are significant in key 1; consider also specifying 'b'",
+			},
+		},
+		{
+			name: "ignored globals",
+			opts: Options{KeyOptions: KeyOptions{Numeric: true, FoldCase: true, Reverse: true}},
+			keys: []string{"1,1V"},
+			want: []string{
+				"text ordering performed using simple byte comparison",
+				"options '-fn' are ignored",
+				"option '-r' only applies to last-resort comparison",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Keys = mustKeys(t, tt.keys...)
+			if got := Warnings(opts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Warnings() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
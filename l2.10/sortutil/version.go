@@ -0,0 +1,70 @@
+package sortutil
+
+import (
+	"cmp"
+	"strings"
+)
+
+// compareVersion сравнивает строки как номера версий (-V).
+// Строка разбивается на чередующиеся нечисловые и числовые части:
+// числовые части сравниваются по значению (1.9 < 1.10, ведущие нули не важны),
+// нечисловые - посимвольно, при этом буквы идут раньше остальных символов.
+// Суффикс предварительной версии ("~rc1" или "-rc1", "-alpha", ...) идет
+// раньше окончания строки, поэтому 1.9.0-rc1 < 1.9.0 < 1.9.0.1.
+func compareVersion(a, b string) int {
+	for a != "" || b != "" {
+		// нечисловая часть
+		for (a != "" && !isDigit(a[0])) || (b != "" && !isDigit(b[0])) {
+			ca, cb := versionOrder(a), versionOrder(b)
+			if ca != cb {
+				return cmp.Compare(ca, cb)
+			}
+			a, b = a[1:], b[1:]
+		}
+
+		// числовая часть
+		a = strings.TrimLeft(a, "0")
+		b = strings.TrimLeft(b, "0")
+		da, db := digitPrefix(a), digitPrefix(b)
+		if len(da) != len(db) {
+			return cmp.Compare(len(da), len(db))
+		}
+		if c := strings.Compare(da, db); c != 0 {
+			return c
+		}
+		a, b = a[len(da):], b[len(db):]
+	}
+	return 0
+}
+
+// versionOrder возвращает вес первого символа нечисловой части:
+// признак предварительной версии < конец части < буквы < остальные символы
+func versionOrder(s string) int {
+	switch {
+	case s == "" || isDigit(s[0]):
+		return 0
+	case s[0] == '~' || (s[0] == '-' && len(s) > 1 && isLetter(s[1])):
+		return -1
+	case isLetter(s[0]):
+		return int(s[0])
+	default:
+		return int(s[0]) + 256
+	}
+}
+
+// digitPrefix возвращает ведущие цифры строки
+func digitPrefix(s string) string {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -2,7 +2,7 @@
 set -Eeuo pipefail
 
 # Сборка бинаря
-go build -o sort sort.go
+go build -o sort .
 
 # Массив тестов: "<name>|<command>|<expected_file>"
 TESTS=(
@@ -15,6 +15,13 @@ TESTS=(
 "t7_stdin|cat testcases/t1_basic.txt | ./sort|testcases/expected/t1_basic.out"
 "t8_k2_tab|./sort -k 2 testcases/t8_k2_tab.txt|testcases/expected/t8_k2_tab.out"
 "t9_nr_combo|./sort -n -r testcases/t2_numeric.txt|testcases/expected/t9_nr_combo.out"
+"t20_version|./sort -V testcases/t20_version.txt|testcases/expected/t20_version.out"
+"t21_general|./sort -g testcases/t21_general.txt|testcases/expected/t21_general.out"
+"t27_unique_key|./sort -u -k 2,2 testcases/t8_k2_tab.txt testcases/t8_k2_tab.txt|testcases/expected/t8_k2_tab.out"
+"t22_merge|./sort -m -n testcases/expected/t2_numeric.out testcases/expected/t2_numeric.out|testcases/expected/t22_merge.out"
+"t23_output_inplace|cp testcases/t1_basic.txt \$TMPDIR_SORT/in.txt && ./sort -o \$TMPDIR_SORT/in.txt \$TMPDIR_SORT/in.txt && cat \$TMPDIR_SORT/in.txt|testcases/expected/t1_basic.out"
+"t28_zero_terminated|tr '\\n' '\\0' < testcases/t1_basic.txt | ./sort -z | tr '\\0' '\\n'|testcases/expected/t1_basic.out"
+"t29_csv|./sort --format=csv --header -k age:n testcases/t29_csv.txt|testcases/expected/t29_csv.out"
 
 # check flag tests
 "t10_check_sorted|./sort -c testcases/expected/t1_basic.out|testcases/expected/empty.out"
@@ -27,11 +34,15 @@ TESTS=(
 "t17_check_months_unsorted|! ./sort -c -M testcases/t5_months.txt|testcases/expected/empty.out"
 "t18_check_human|./sort -c -h testcases/expected/t6_human.out|testcases/expected/empty.out"
 "t19_check_human_unsorted|! ./sort -c -h testcases/t6_human.txt|testcases/expected/empty.out"
+"t24_check_quiet|! ./sort -C testcases/t1_basic.txt 2>&1|testcases/expected/empty.out"
+"t25_check_disorder|! ./sort -c testcases/t1_basic.txt 2>&1|testcases/expected/t25_check_disorder.out"
+"t26_check_unique|! ./sort -c -u testcases/t26_check_unique.txt 2>&1|testcases/expected/t26_check_unique.out"
 )
 
 ok=0
 fail=0
 tmp_out="$(mktemp)"
+export TMPDIR_SORT="$(mktemp -d)"
 
 for t in "${TESTS[@]}"; do
     name="${t%%|*}"                  # имя теста
@@ -58,6 +69,7 @@ done
 
 
 rm -f "$tmp_out"
+rm -rf "$TMPDIR_SORT"
 
 echo "===================="
 echo "Passed: $ok"
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// ahoCorasick - автомат Ахо–Корасик: находит вхождения любой строки из большого
+// списка за один проход по строке, вместо strings.Contains по каждому шаблону.
+// Переходы идут по рунам, с ignoreCase - по рунам в нижнем регистре,
+// поэтому смещения совпадений указывают в исходную строку.
+type ahoCorasick struct {
+	nodes      []acNode // 0 - корень
+	ignoreCase bool
+}
+
+// acNode - узел бора шаблонов
+type acNode struct {
+	next  map[rune]int32
+	fail  int32 // узел самого длинного собственного суффикса пути, который есть в боре
+	dict  int32 // ближайший по fail-ссылкам узел, где кончается шаблон, -1 - нет
+	depth int32 // длина пути от корня в рунах
+	final bool  // здесь кончается шаблон
+}
+
+func newAhoCorasick(patterns []string, ignoreCase bool) *ahoCorasick {
+	a := &ahoCorasick{nodes: []acNode{{dict: -1}}, ignoreCase: ignoreCase}
+
+	for _, p := range patterns {
+		n := int32(0)
+		for _, r := range p {
+			r = a.fold(r)
+			child, ok := a.nodes[n].next[r]
+			if !ok {
+				child = int32(len(a.nodes))
+				a.nodes = append(a.nodes, acNode{dict: -1, depth: a.nodes[n].depth + 1})
+				if a.nodes[n].next == nil {
+					a.nodes[n].next = make(map[rune]int32)
+				}
+				a.nodes[n].next[r] = child
+			}
+			n = child
+		}
+		a.nodes[n].final = true
+	}
+
+	// Ссылки строятся обходом в ширину: у более коротких путей они уже готовы
+	var queue []int32
+	for _, child := range a.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+
+		f := a.nodes[n].fail
+		if a.nodes[f].final {
+			a.nodes[n].dict = f
+		} else {
+			a.nodes[n].dict = a.nodes[f].dict
+		}
+		for r, child := range a.nodes[n].next {
+			a.nodes[child].fail = a.step(f, r)
+			queue = append(queue, child)
+		}
+	}
+	return a
+}
+
+// fold приводит руну к виду, в котором она хранится в боре
+func (a *ahoCorasick) fold(r rune) rune {
+	switch {
+	case !a.ignoreCase:
+		return r
+	case r < utf8.RuneSelf:
+		if 'A' <= r && r <= 'Z' {
+			r += 'a' - 'A'
+		}
+		return r
+	}
+	return unicode.ToLower(r)
+}
+
+// step возвращает узел после перехода из n по руне r
+func (a *ahoCorasick) step(n int32, r rune) int32 {
+	for {
+		if next, ok := a.nodes[n].next[r]; ok {
+			return next
+		}
+		if n == 0 {
+			return 0
+		}
+		n = a.nodes[n].fail
+	}
+}
+
+// match проверяет, есть ли в line хотя бы один шаблон
+func (a *ahoCorasick) match(line string) bool {
+	if a.nodes[0].final {
+		return true
+	}
+	n := int32(0)
+	for _, r := range line {
+		n = a.step(n, a.fold(r))
+		if a.nodes[n].final || a.nodes[n].dict >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// find ищет в line, начиная с from, самое левое непустое вхождение шаблона,
+// а из них - самое длинное, как grep. accept, если задан, отбрасывает
+// неподходящие вхождения line[start:end] (для -w).
+func (a *ahoCorasick) find(line string, from int, accept func(start, end int) bool) (int, int, bool) {
+	bestStart, bestEnd := -1, -1
+	var starts []int // смещения начал пройденных рун
+	n := int32(0)
+
+	for i := from; i < len(line); {
+		r, size := utf8.DecodeRuneInString(line[i:])
+		starts = append(starts, i)
+		i += size
+		n = a.step(n, a.fold(r))
+
+		// Вхождения, кончающиеся в i, - от самого длинного к самому короткому
+		out := n
+		if !a.nodes[out].final {
+			out = a.nodes[out].dict
+		}
+		for ; out > 0; out = a.nodes[out].dict {
+			start := starts[len(starts)-int(a.nodes[out].depth)]
+			if bestStart >= 0 && start > bestStart {
+				break
+			}
+			if accept == nil || accept(start, i) {
+				bestStart, bestEnd = start, i
+				break
+			}
+		}
+
+		// Следующие вхождения начнутся не раньше начала текущего пути в боре
+		pathStart := i
+		if d := int(a.nodes[n].depth); d > 0 {
+			pathStart = starts[len(starts)-d]
+		}
+		if bestStart >= 0 && pathStart > bestStart {
+			break
+		}
+	}
+	return bestStart, bestEnd, bestStart >= 0
+}
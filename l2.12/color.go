@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// colorMode - значение --color: когда раскрашивать вывод
+type colorMode string
+
+const (
+	colorAuto   colorMode = "auto"
+	colorAlways colorMode = "always"
+	colorNever  colorMode = "never"
+)
+
+func (c *colorMode) String() string {
+	return string(*c)
+}
+
+// Set принимает те же значения, что и GNU grep; --color без значения - auto
+func (c *colorMode) Set(s string) error {
+	switch s {
+	case "always", "yes", "force":
+		*c = colorAlways
+	case "never", "no", "none":
+		*c = colorNever
+	case "auto", "tty", "if-tty", "true":
+		*c = colorAuto
+	default:
+		return fmt.Errorf("invalid color mode %q, want auto, always or never", s)
+	}
+	return nil
+}
+
+// IsBoolFlag разрешает писать --color без значения
+func (c *colorMode) IsBoolFlag() bool {
+	return true
+}
+
+// enabled решает, раскрашивать ли вывод: для auto - только в терминал, кроме TERM=dumb
+func (c colorMode) enabled() bool {
+	switch c {
+	case colorAlways:
+		return true
+	case colorNever:
+		return false
+	}
+	if term := os.Getenv("TERM"); term == "" || term == "dumb" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// palette - цвета частей вывода в виде параметров SGR ("01;31"), пустой цвет - без раскраски.
+// Имена полей в комментариях - ключи GREP_COLORS.
+type palette struct {
+	selectedMatch string // ms: совпадение в выбранной строке
+	contextMatch  string // mc: совпадение в строке контекста (с -v)
+	selectedLine  string // sl: выбранная строка целиком
+	contextLine   string // cx: строка контекста целиком
+	fileName      string // fn
+	lineNum       string // ln
+	byteOffset    string // bn
+	separator     string // se: разделители ':' '-' и Divider
+	noErase       bool   // ne: не добавлять \33[K (очистку до конца строки)
+}
+
+// defaultPalette - цвета GNU grep по умолчанию
+var defaultPalette = palette{
+	selectedMatch: "01;31",
+	contextMatch:  "01;31",
+	fileName:      "35",
+	lineNum:       "32",
+	byteOffset:    "32",
+	separator:     "36",
+}
+
+// parseGrepColors меняет цвета p по строке в формате GREP_COLORS,
+// например "ms=01;32:fn=34:ne". Неизвестные ключи пропускаются, на некорректном
+// значении разбор останавливается, как в GNU grep.
+func parseGrepColors(s string, p palette) palette {
+	reverse := false
+	for _, item := range strings.Split(s, ":") {
+		key, value, hasValue := strings.Cut(item, "=")
+		if hasValue && strings.Trim(value, "0123456789;") != "" {
+			break
+		}
+
+		switch key {
+		case "mt":
+			p.selectedMatch, p.contextMatch = value, value
+		case "ms":
+			p.selectedMatch = value
+		case "mc":
+			p.contextMatch = value
+		case "sl":
+			p.selectedLine = value
+		case "cx":
+			p.contextLine = value
+		case "fn":
+			p.fileName = value
+		case "ln":
+			p.lineNum = value
+		case "bn":
+			p.byteOffset = value
+		case "se":
+			p.separator = value
+		case "ne":
+			p.noErase = !hasValue
+		case "rv":
+			reverse = !hasValue
+		}
+	}
+
+	// rv: с -v цвета sl и cx меняются местами, как в GNU grep
+	if reverse && *invertMatch {
+		p.selectedLine, p.contextLine = p.contextLine, p.selectedLine
+	}
+	return p
+}
+
+// start возвращает последовательность, включающую цвет code
+func (p palette) start(code string) string {
+	if p.noErase {
+		return "\033[" + code + "m"
+	}
+	return "\033[" + code + "m\033[K"
+}
+
+// end возвращает последовательность, сбрасывающую цвет
+func (p palette) end() string {
+	if p.noErase {
+		return "\033[m"
+	}
+	return "\033[m\033[K"
+}
+
+// paint печатает text в w цветом code, с пустым цветом - как есть
+func (p palette) paint(w io.Writer, code, text string) {
+	if code == "" {
+		io.WriteString(w, text)
+		return
+	}
+	io.WriteString(w, p.start(code)+text+p.end())
+}
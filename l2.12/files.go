@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// stringList - значение флага, который можно указать несколько раз
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// fileFilter отбирает файлы и каталоги по glob-шаблонам имени
+// (--include, --exclude, --exclude-dir)
+type fileFilter struct {
+	include    []string
+	exclude    []string
+	excludeDir []string
+}
+
+// matchAny проверяет, подходит ли имя name хотя бы под один шаблон
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// skipFile проверяет, нужно ли пропустить файл path
+func (f fileFilter) skipFile(path string) bool {
+	name := filepath.Base(path)
+	if len(f.include) > 0 && !matchAny(f.include, name) {
+		return true
+	}
+	return matchAny(f.exclude, name)
+}
+
+// skipDir проверяет, нужно ли пропустить каталог path при обходе
+func (f fileFilter) skipDir(path string) bool {
+	return matchAny(f.excludeDir, filepath.Base(path))
+}
+
+// walkFiles обходит каталог root и вызывает fn для каждого подходящего файла.
+// С follow символические ссылки внутри root разыменовываются (-R),
+// без него - пропускаются (-r). Каталоги по ссылкам обходятся не больше одного раза.
+// Ошибки чтения каталогов передаются в onErr, обход продолжается.
+func walkFiles(root string, follow bool, filter fileFilter, fn func(path string), onErr func(error)) {
+	walkDir(root, follow, filter, make(map[string]bool), fn, onErr)
+}
+
+func walkDir(root string, follow bool, filter fileFilter, visited map[string]bool, fn func(path string), onErr func(error)) {
+	if real, err := filepath.EvalSymlinks(root); err == nil {
+		if visited[real] {
+			return
+		}
+		visited[real] = true
+	}
+
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			onErr(err)
+			return nil
+		}
+
+		switch {
+		case d.IsDir():
+			if path != root && filter.skipDir(path) {
+				return filepath.SkipDir
+			}
+		case d.Type()&fs.ModeSymlink != 0:
+			if !follow {
+				return nil
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				onErr(err)
+				return nil
+			}
+			if info.IsDir() {
+				// со слешем в конце WalkDir обходит каталог, на который указывает ссылка
+				if !filter.skipDir(path) {
+					walkDir(path+string(filepath.Separator), follow, filter, visited, fn, onErr)
+				}
+				return nil
+			}
+			if !filter.skipFile(path) {
+				fn(path)
+			}
+		case d.Type().IsRegular():
+			if !filter.skipFile(path) {
+				fn(path)
+			}
+		}
+		return nil
+	})
+}
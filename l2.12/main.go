@@ -2,20 +2,25 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"cmp"
 	"flag"
 	"fmt"
+	"io"
 	"os"
-	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync/atomic"
 )
 
 const Divider = "--"
 
-type MatchResult struct {
+// contextLine - строка входа вместе с ее номером и смещением
+type contextLine struct {
 	line    string
 	lineNum int
-	matched bool
-	printed bool
+	offset  int // смещение начала строки от начала входа в байтах (-b)
 }
 
 var (
@@ -28,125 +33,432 @@ var (
 	fixedString   = flag.Bool("F", false, "Treat pattern as fixed string")
 	lineNumber    = flag.Bool("n", false, "Print line numbers")
 	extended      = flag.Bool("E", false, "Extended mode, does nothing, for grep compatibility")
+	recursive     = flag.Bool("r", false, "Search directories recursively, skipping symlinks inside them")
+	dereference   = flag.Bool("R", false, "Like -r, but follow all symlinks")
+	withFilename  = flag.Bool("H", false, "Print the file name for each match")
+	noFilename    = flag.Bool("h", false, "Suppress the file name prefix on output")
+	onlyMatching  = flag.Bool("o", false, "Print only the matched parts of matching lines, each on its own line")
+	byteOffset    = flag.Bool("b", false, "Print the byte offset of each line (with -o, of each match) before it")
+	filesWith     = flag.Bool("l", false, "Print only names of files with matches")
+	filesWithout  = flag.Bool("L", false, "Print only names of files without matches")
+	maxCount      = flag.Int("m", -1, "Stop reading a file after N selected lines")
+	quiet         = flag.Bool("q", false, "Quiet: print nothing, exit with status 0 on the first match")
+	wordRegexp    = flag.Bool("w", false, "Match only whole words")
+	lineRegexp    = flag.Bool("x", false, "Match only whole lines")
+	jobs          = flag.Int("j", runtime.NumCPU(), "Search up to N files in parallel, output keeps argument order")
 )
 
-var pattern string
+var (
+	include    stringList
+	exclude    stringList
+	excludeDir stringList
+	exprs      stringList
+	exprFiles  stringList
+	color      = colorAuto
+)
+
+// colors - цвета вывода, пустая палитра - без раскраски
+var colors palette
+
+func init() {
+	flag.Var(&exprs, "e", "Use PATTERN for matching (may be repeated), all arguments are files then")
+	flag.Var(&exprFiles, "f", "Read patterns from FILE, one per line (may be repeated, - is STDIN)")
+	flag.Var(&include, "include", "Search only files whose base name matches GLOB (may be repeated)")
+	flag.Var(&exclude, "exclude", "Skip files whose base name matches GLOB (may be repeated)")
+	flag.Var(&excludeDir, "exclude-dir", "Skip directories whose base name matches GLOB when recursing (may be repeated)")
+	flag.Var(&color, "color", "Highlight matches, file names, line numbers and separators: auto, always or never; colors are taken from GREP_COLORS")
+}
+
+// binaryPeek - размер буфера чтения: NUL ищется в том, что пришло первым чтением, но не больше
+const binaryPeek = 8192
+
+// stdinName - имя STDIN в выводе
+const stdinName = "(standard input)"
+
+// hadError - при обработке входов была ошибка
+var hadError bool
 
-func filterInput(input *os.File) error {
-	scanner := bufio.NewScanner(input)
-	var lines []MatchResult
+// selected - хотя бы в одном входе нашлась выбранная строка; пишется из горутин -j
+var selected atomic.Bool
+
+// reportError печатает ошибку, обработка остальных входов продолжается
+func reportError(err error) {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	hadError = true
+}
+
+// readPatterns возвращает шаблоны из -e и файлов -f и оставшиеся аргументы - файлы.
+// Без -e и -f шаблон - первый аргумент. Шаблон с переводами строк - это несколько
+// шаблонов, как в GNU grep; пустой файл -f не добавляет ни одного.
+func readPatterns(args []string) (patterns, files []string, err error) {
+	values := []string(exprs)
+	if len(exprs) == 0 && len(exprFiles) == 0 {
+		values, args = args[:1], args[1:]
+	}
+
+	for _, name := range exprFiles {
+		var data []byte
+		if name == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(name)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(data) > 0 {
+			values = append(values, strings.TrimSuffix(string(data), "\n"))
+		}
+	}
+
+	for _, v := range values {
+		patterns = append(patterns, strings.Split(v, "\n")...)
+	}
+	return patterns, args, nil
+}
+
+// filterInput читает вход name построчно и сразу печатает совпадения с m с контекстом,
+// храня в памяти не больше -B строк. Для двоичного входа (с NUL в первом прочитанном
+// блоке) вместо строк печатается только сообщение о совпадении.
+// С -l и -q чтение заканчивается на первой выбранной строке, с -m N - после N-й
+// и строк контекста после нее.
+func filterInput(input io.Reader, name string, p *printer, m matcher) error {
+	// Проверяем только уже прочитанное: ожидание полного блока задержало бы
+	// вывод совпадений из канала вроде tail -f
+	br := bufio.NewReaderSize(input, binaryPeek)
+	br.Peek(1)
+	head, _ := br.Peek(br.Buffered())
+	binary := bytes.IndexByte(head, 0) >= 0
+	printLines := !binary && !*countOnly && !*quiet && !*filesWith && !*filesWithout
+
+	// Смещение строки считается по продвижению сканера: ScanLines отбрасывает конец строки и \r перед ним
+	scanner := bufio.NewScanner(br)
+	pos, lineStart := 0, 0
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		if token != nil {
+			lineStart = pos
+		}
+		pos += advance
+		return advance, token, err
+	})
+
+	p.startFile(name)
 	lineNum := 0
+	count := 0
 
 	for scanner.Scan() {
 		line := scanner.Text()
 		lineNum++
-		matched := isMatch(line)
-		lines = append(lines, MatchResult{
-			line:    line,
-			lineNum: lineNum,
-			matched: matched,
-			printed: false,
-		})
+		l := contextLine{line: line, lineNum: lineNum, offset: lineStart}
+
+		if *maxCount >= 0 && count >= *maxCount {
+			// После -m N выбранных строк печатается только контекст после последней
+			if !printLines || p.afterLeft == 0 {
+				break
+			}
+			p.process(l, false)
+			continue
+		}
+
+		matched := m.match(line) != *invertMatch
+		if !matched {
+			if printLines {
+				p.process(l, false)
+			}
+			continue
+		}
+
+		count++
+		selected.Store(true)
+		switch {
+		case *quiet, *filesWithout:
+			// Вход уже выбран (-q) или точно не попадет в список -L
+			return nil
+		case *filesWith:
+			p.printName(name)
+			return nil
+		case *countOnly:
+		case binary:
+			fmt.Fprintf(p.w, "Binary file %s matches\n", name)
+			return nil
+		default:
+			p.process(l, true)
+		}
 	}
 
 	if err := scanner.Err(); err != nil {
 		return err
 	}
 
-	// Если нужно только количество
-	if *countOnly {
-		count := 0
-		for _, result := range lines {
-			if result.matched {
-				count++
-			}
+	switch {
+	case *quiet, *filesWith:
+	case *filesWithout:
+		if count == 0 {
+			p.printName(name)
 		}
-		fmt.Println(count)
-		return nil
+	case *countOnly:
+		if p.withFilename {
+			p.colors.paint(p.w, p.colors.fileName, name)
+			p.colors.paint(p.w, p.colors.separator, ":")
+		}
+		fmt.Fprintln(p.w, count)
 	}
-
-	// Обработка вывода
-	return processOutput(lines)
+	return nil
 }
 
-func isMatch(line string) bool {
-	var matched bool
-	searchLine := line
-	searchPattern := pattern
+// searchFile ищет совпадения в файле name, "-" - STDIN
+func searchFile(name string, p *printer, m matcher) error {
+	if name == "-" {
+		return filterInput(os.Stdin, stdinName, p, m)
+	}
 
-	if *ignoreCase {
-		searchLine = strings.ToLower(searchLine)
-		searchPattern = strings.ToLower(searchPattern)
+	f, err := os.Open(name)
+	if err != nil {
+		return err
 	}
+	defer f.Close()
 
-	if *fixedString {
-		matched = strings.Contains(searchLine, searchPattern)
-	} else {
-		// Компилируем регулярное выражение с учетом регистра
-		var re *regexp.Regexp
-		var err error
+	if err := filterInput(f, name, p, m); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
 
-		if *ignoreCase {
-			re, err = regexp.Compile("(?i)" + pattern)
-		} else {
-			re, err = regexp.Compile(pattern)
+// eachFile вызывает fn для файла name или, с -r/-R, для всех файлов каталога,
+// onErr - для ошибок, после которых обход продолжается.
+// Пустое name - текущий каталог, имена файлов в нем передаются без "./".
+func eachFile(name string, filter fileFilter, fn func(path string), onErr func(error)) {
+	if name == "-" {
+		fn(name)
+		return
+	}
+
+	root := name
+	if root == "" {
+		root = "."
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		onErr(err)
+		return
+	}
+
+	if !info.IsDir() {
+		if !filter.skipFile(name) {
+			fn(name)
+		}
+		return
+	}
+	if !*recursive && !*dereference {
+		onErr(fmt.Errorf("%s: is a directory", name))
+		return
+	}
+	walkFiles(root, *dereference, filter, func(path string) {
+		// WalkDir убирает "./" в начале путей, а grep печатает пути так, как указан каталог
+		if name == "." || strings.HasPrefix(name, "./") {
+			path = "./" + path
 		}
+		fn(path)
+	}, onErr)
+}
 
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Invalid regex pattern: %v\n", err)
-			os.Exit(2)
+// search ищет совпадения во всех файлах files и печатает их в w в порядке аргументов.
+// При workers > 1 файлы просматриваются параллельно.
+func search(w io.Writer, files []string, filter fileFilter, showName bool, m matcher, workers int) {
+	if workers > 1 {
+		searchParallel(w, files, filter, showName, m, workers)
+		return
+	}
+
+	p := newPrinter(w, showName, m)
+	for _, name := range files {
+		// С -q после первого совпадения остальные файлы не читаются
+		if *quiet && selected.Load() {
+			break
 		}
-		matched = re.MatchString(line)
+		eachFile(name, filter, func(path string) {
+			if *quiet && selected.Load() {
+				return
+			}
+			if err := searchFile(path, p, m); err != nil {
+				reportError(err)
+			}
+		}, reportError)
 	}
+}
 
-	if *invertMatch {
-		return !matched
+// ringBuffer хранит последние строки входа для контекста -B
+type ringBuffer struct {
+	lines []contextLine
+	start int
+	size  int
+}
+
+func newRingBuffer(capacity int) *ringBuffer {
+	return &ringBuffer{lines: make([]contextLine, capacity)}
+}
+
+// push добавляет строку, вытесняя самую старую при заполнении буфера
+func (r *ringBuffer) push(l contextLine) {
+	if len(r.lines) == 0 {
+		return
 	}
-	return matched
+	if r.size < len(r.lines) {
+		r.lines[(r.start+r.size)%len(r.lines)] = l
+		r.size++
+		return
+	}
+	r.lines[r.start] = l
+	r.start = (r.start + 1) % len(r.lines)
 }
 
-// processOutput печатает результат
-func processOutput(lines []MatchResult) error {
-	// Сначала помечаем все строки для печати
-	for i, result := range lines {
-		if result.matched {
-			// Помечаем строки до
-			start := max(0, i-*beforeContext)
-			for j := start; j < i; j++ {
-				lines[j].printed = true
-			}
+// drain передает строки в fn от старой к новой и очищает буфер
+func (r *ringBuffer) drain(fn func(contextLine)) {
+	for i := range r.size {
+		fn(r.lines[(r.start+i)%len(r.lines)])
+	}
+	r.start, r.size = 0, 0
+}
 
-			// Помечаем саму строку
-			lines[i].printed = true
+// printer печатает совпадения с контекстом по мере чтения входа
+type printer struct {
+	w            io.Writer
+	withFilename bool        // печатать имя файла перед строками
+	name         string      // имя текущего файла
+	before       *ringBuffer // строки перед следующим совпадением (-B)
+	afterLeft    int         // сколько строк после совпадения еще нужно напечатать (-A)
+	lastPrinted  int         // номер последней напечатанной строки файла, 0 - ничего не напечатано
+	printedAny   bool        // что-то напечатано в одном из предыдущих или текущем файле
+	hasContext   bool
+	m            matcher // для поиска границ совпадений (-o и --color)
+	colors       palette
+}
 
-			// Помечаем строки после
-			end := min(len(lines)-1, i+*afterContext)
-			for j := i + 1; j <= end; j++ {
-				lines[j].printed = true
-			}
-		}
+func newPrinter(w io.Writer, withFilename bool, m matcher) *printer {
+	return &printer{
+		w:            w,
+		withFilename: withFilename,
+		m:            m,
+		colors:       colors,
+		before:       newRingBuffer(*beforeContext),
+		hasContext:   *afterContext > 0 || *beforeContext > 0 || *context > 0,
 	}
+}
 
-	lastPrinted := -2 // Инициализируем значением, гарантирующим, что первая строка не будет иметь разделитель
-	hasContext := *afterContext > 0 || *beforeContext > 0 || *context > 0
+// startFile начинает вывод совпадений из файла name
+func (p *printer) startFile(name string) {
+	p.name = name
+	p.before.drain(func(contextLine) {})
+	p.afterLeft = 0
+	p.lastPrinted = 0
+}
 
-	for i, result := range lines {
-		if result.printed {
-			// Добавляем разделитель только если есть контекст И это не первая печатаемая строка
-			// И предыдущая строка не была напечатана (есть разрыв)
-			if hasContext && lastPrinted != -2 && lastPrinted != i-1 {
-				fmt.Println(Divider)
-			}
+// process обрабатывает очередную строку входа
+func (p *printer) process(l contextLine, matched bool) {
+	if matched {
+		// Печатаем строки до, саму строку и начинаем отсчет строк после
+		p.before.drain(func(c contextLine) { p.print(c, '-') })
+		p.print(l, ':')
+		p.afterLeft = *afterContext
+		return
+	}
 
-			if *lineNumber {
-				fmt.Printf("%d:", result.lineNum)
-			}
-			fmt.Println(result.line)
-			lastPrinted = i
+	if p.afterLeft > 0 {
+		p.afterLeft--
+		p.print(l, '-')
+		return
+	}
+	p.before.push(l)
+}
+
+// print печатает строку, отделяя разделителем несмежные группы строк.
+// sep отделяет имя файла и номер строки: ':' для совпадений, '-' для контекста.
+func (p *printer) print(l contextLine, sep byte) {
+	// Добавляем разделитель только если есть контекст И это не первая печатаемая строка
+	// И предыдущая строка не была напечатана (есть разрыв, в том числе между файлами)
+	gap := p.lastPrinted == 0 || p.lastPrinted != l.lineNum-1
+	if p.hasContext && p.printedAny && gap {
+		p.colors.paint(p.w, p.colors.separator, Divider)
+		fmt.Fprintln(p.w)
+	}
+
+	p.lastPrinted = l.lineNum
+	p.printedAny = true
+
+	if !*onlyMatching {
+		p.printPrefix(l, sep, l.offset)
+		p.printLine(l.line, sep)
+		return
+	}
+	// С -o строки контекста не печатаются, но разделяют группы, как в GNU grep
+	if sep != ':' {
+		return
+	}
+	for _, span := range p.m.findAll(l.line) {
+		p.printPrefix(l, sep, l.offset+span[0])
+		p.colors.paint(p.w, p.colors.selectedMatch, l.line[span[0]:span[1]])
+		fmt.Fprintln(p.w)
+	}
+}
+
+// printPrefix печатает перед строкой имя файла, номер строки и смещение offset (-b)
+func (p *printer) printPrefix(l contextLine, sep byte, offset int) {
+	if p.withFilename {
+		p.colors.paint(p.w, p.colors.fileName, p.name)
+		p.colors.paint(p.w, p.colors.separator, string(sep))
+	}
+	if *lineNumber {
+		p.colors.paint(p.w, p.colors.lineNum, strconv.Itoa(l.lineNum))
+		p.colors.paint(p.w, p.colors.separator, string(sep))
+	}
+	if *byteOffset {
+		p.colors.paint(p.w, p.colors.byteOffset, strconv.Itoa(offset))
+		p.colors.paint(p.w, p.colors.separator, string(sep))
+	}
+}
+
+// printLine печатает текст строки с выделенными совпадениями: цвет ms в выбранных
+// строках, mc - в строках контекста (с -v совпадения есть только в них).
+// Цвет строки sl/cx, как в GNU grep, восстанавливается после каждого совпадения.
+func (p *printer) printLine(line string, sep byte) {
+	lineColor, matchColor := p.colors.selectedLine, p.colors.selectedMatch
+	if sep != ':' {
+		lineColor, matchColor = p.colors.contextLine, p.colors.contextMatch
+	}
+	if lineColor == "" && matchColor == "" {
+		fmt.Fprintln(p.w, line)
+		return
+	}
+
+	var spans [][]int
+	if matchColor != "" && (sep == ':') != *invertMatch {
+		spans = p.m.findAll(line)
+	}
+
+	pos := 0
+	if lineColor != "" && line != "" {
+		io.WriteString(p.w, p.colors.start(lineColor))
+	}
+	for _, span := range spans {
+		io.WriteString(p.w, line[pos:span[0]])
+		p.colors.paint(p.w, matchColor, line[span[0]:span[1]])
+		pos = span[1]
+		if lineColor != "" && pos < len(line) {
+			io.WriteString(p.w, p.colors.start(lineColor))
 		}
 	}
+	io.WriteString(p.w, line[pos:])
+	if lineColor != "" && pos < len(line) {
+		io.WriteString(p.w, p.colors.end())
+	}
+	fmt.Fprintln(p.w)
+}
 
-	return nil
+// printName печатает имя файла для -l и -L
+func (p *printer) printName(name string) {
+	p.colors.paint(p.w, p.colors.fileName, name)
+	fmt.Fprintln(p.w)
 }
 
 func main() {
@@ -158,33 +470,72 @@ func main() {
 	}
 
 	args := flag.Args()
-	if len(args) < 1 {
+	if len(args) < 1 && len(exprs) == 0 && len(exprFiles) == 0 {
 		fmt.Fprintln(os.Stderr, "Usage: grep [flags] pattern [file]")
-		os.Exit(1)
+		os.Exit(2)
 	}
 
-	pattern = args[0]
-	var filename string
-	if len(args) > 1 {
-		filename = args[1]
+	if color.enabled() {
+		colors = parseGrepColors(os.Getenv("GREP_COLORS"), defaultPalette)
 	}
 
-	var input *os.File
-	if filename == "" {
-		input = os.Stdin
-	} else {
-		var err error
-		input, err = os.Open(filename)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error opening file: %v\n", err)
-			os.Exit(1)
-		}
-		defer input.Close()
+	// Шаблоны проверяются до чтения входа
+	patterns, files, err := readPatterns(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
 	}
-
-	err := filterInput(input)
+	m, err := newMatcher(patterns, matchOptions{
+		fixed:      *fixedString,
+		ignoreCase: *ignoreCase,
+		word:       *wordRegexp,
+		line:       *lineRegexp,
+	})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	if len(files) == 0 {
+		// -r без файлов ищет в текущем каталоге
+		if *recursive || *dereference {
+			files = []string{""}
+		} else {
+			files = []string{"-"}
+		}
+	}
+
+	// Имя файла печатается, если файлов несколько или ищем по каталогу
+	showName := len(files) > 1
+	if *recursive || *dereference {
+		if info, err := os.Stat(cmp.Or(files[0], ".")); err == nil && info.IsDir() {
+			showName = true
+		}
+	}
+	switch {
+	case *noFilename:
+		showName = false
+	case *withFilename:
+		showName = true
+	}
+
+	// Один файл просматривается потоково, без буферизации вывода
+	workers := *jobs
+	if len(files) == 1 && !*recursive && !*dereference {
+		workers = 1
+	}
+
+	filter := fileFilter{include: include, exclude: exclude, excludeDir: excludeDir}
+	search(os.Stdout, files, filter, showName, m, workers)
+
+	// Коды завершения grep: 0 - есть выбранные строки, 1 - нет, 2 - ошибка.
+	// С -q найденное совпадение важнее ошибок.
+	switch {
+	case *quiet && selected.Load():
+		os.Exit(0)
+	case hadError:
+		os.Exit(2)
+	case !selected.Load():
 		os.Exit(1)
 	}
 }
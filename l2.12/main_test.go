@@ -0,0 +1,415 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestNewMatcher проверяет matcher для фиксированных строк и регулярных выражений
+func TestNewMatcher(t *testing.T) {
+	tests := []struct {
+		pattern    string
+		fixed      bool
+		ignoreCase bool
+		line       string
+		want       bool
+	}{
+		{"error", true, false, "an error here", true},
+		{"error", true, false, "an ERROR here", false},
+		{"error", true, true, "an ERROR here", true},
+		{"a.c", true, false, "abc", false},
+		{"a.c", false, false, "abc", true},
+		{"error [0-9]+", false, false, "error 42", true},
+		{"ERROR", false, true, "error 42", true},
+		{"ERROR", false, false, "error 42", false},
+	}
+
+	for _, tt := range tests {
+		m, err := newMatcher([]string{tt.pattern}, matchOptions{fixed: tt.fixed, ignoreCase: tt.ignoreCase})
+		if err != nil {
+			t.Fatalf("newMatcher(%q): %v", tt.pattern, err)
+		}
+		if got := m.match(tt.line); got != tt.want {
+			t.Errorf("newMatcher(%q, fixed=%v, ignoreCase=%v).match(%q) = %v, want %v",
+				tt.pattern, tt.fixed, tt.ignoreCase, tt.line, got, tt.want)
+		}
+	}
+
+	if _, err := newMatcher([]string{"["}, matchOptions{}); err == nil {
+		t.Error("expected error for invalid regex")
+	}
+	if _, err := newMatcher([]string{"["}, matchOptions{fixed: true}); err != nil {
+		t.Errorf("fixed string must not be parsed as regex: %v", err)
+	}
+}
+
+// TestFindAll проверяет границы совпадений для -o
+func TestFindAll(t *testing.T) {
+	tests := []struct {
+		pattern    string
+		fixed      bool
+		ignoreCase bool
+		line       string
+		want       [][]int
+	}{
+		{"foo", true, false, "a foo foo", [][]int{{2, 5}, {6, 9}}},
+		{"aa", true, false, "aaaa", [][]int{{0, 2}, {2, 4}}},
+		{"FOO", true, true, "a foo", [][]int{{2, 5}}},
+		{"ы", true, true, "ЫxЫ", [][]int{{0, 2}, {3, 5}}},
+		{"[0-9]+", false, false, "id=12 n=3", [][]int{{3, 5}, {8, 9}}},
+		{"x*", false, false, "abc", nil},
+		{"foo", true, false, "bar", nil},
+	}
+
+	for _, tt := range tests {
+		m, err := newMatcher([]string{tt.pattern}, matchOptions{fixed: tt.fixed, ignoreCase: tt.ignoreCase})
+		if err != nil {
+			t.Fatalf("newMatcher(%q): %v", tt.pattern, err)
+		}
+		if got := m.findAll(tt.line); !reflect.DeepEqual(got, tt.want) && len(got)+len(tt.want) > 0 {
+			t.Errorf("newMatcher(%q, fixed=%v, ignoreCase=%v).findAll(%q) = %v, want %v",
+				tt.pattern, tt.fixed, tt.ignoreCase, tt.line, got, tt.want)
+		}
+	}
+}
+
+// TestParseGrepColors проверяет разбор GREP_COLORS
+func TestParseGrepColors(t *testing.T) {
+	tests := []struct {
+		env  string
+		want palette
+	}{
+		{"", defaultPalette},
+		{"mt=01;32:fn=34:ne", palette{
+			selectedMatch: "01;32", contextMatch: "01;32", fileName: "34",
+			lineNum: "32", byteOffset: "32", separator: "36", noErase: true,
+		}},
+		{"se=:sl=1", palette{
+			selectedMatch: "01;31", contextMatch: "01;31", selectedLine: "1",
+			fileName: "35", lineNum: "32", byteOffset: "32",
+		}},
+		// разбор останавливается на некорректном значении
+		{"ln=33:fn=red:bn=1", palette{
+			selectedMatch: "01;31", contextMatch: "01;31",
+			fileName: "35", lineNum: "33", byteOffset: "32", separator: "36",
+		}},
+	}
+
+	for _, tt := range tests {
+		if got := parseGrepColors(tt.env, defaultPalette); got != tt.want {
+			t.Errorf("parseGrepColors(%q) = %+v, want %+v", tt.env, got, tt.want)
+		}
+	}
+}
+
+// bruteFind ищет самое левое, а из них самое длинное вхождение перебором, для сравнения с ahoCorasick
+func bruteFind(line string, from int, patterns []string, accept func(start, end int) bool) (int, int, bool) {
+	for start := from; start < len(line); start++ {
+		end := -1
+		for _, p := range patterns {
+			if p != "" && strings.HasPrefix(line[start:], p) && len(p) > end-start &&
+				(accept == nil || accept(start, start+len(p))) {
+				end = start + len(p)
+			}
+		}
+		if end >= 0 {
+			return start, end, true
+		}
+	}
+	return -1, -1, false
+}
+
+// TestAhoCorasick сравнивает поиск автоматом с перебором на строках из пересекающихся шаблонов
+func TestAhoCorasick(t *testing.T) {
+	patterns := []string{"he", "she", "his", "hers", "e", "hershe", "sh", "", "ушел"}
+	ac := newAhoCorasick(patterns, false)
+	lines := []string{"", "ushers", "hishershe", "she sells", "xyz", "h", "hhhe", "ушелушел", "шел"}
+
+	for _, line := range lines {
+		for from := 0; from <= len(line); from++ {
+			for _, word := range []bool{false, true} {
+				var accept func(start, end int) bool
+				if word {
+					accept = func(start, end int) bool { return wordBounded(line, start, end) }
+				}
+				gotStart, gotEnd, gotOK := ac.find(line, from, accept)
+				wantStart, wantEnd, wantOK := bruteFind(line, from, patterns, accept)
+				if gotStart != wantStart || gotEnd != wantEnd || gotOK != wantOK {
+					t.Errorf("find(%q, %d, word=%v) = %d, %d, %v, want %d, %d, %v",
+						line, from, word, gotStart, gotEnd, gotOK, wantStart, wantEnd, wantOK)
+				}
+			}
+		}
+	}
+
+	if !ac.match("anything") {
+		t.Error("empty pattern must match every line")
+	}
+	if newAhoCorasick(nil, false).match("anything") {
+		t.Error("automaton without patterns must not match")
+	}
+	if ci := newAhoCorasick([]string{"ПРИвет", "World"}, true); !ci.match("привет, WORLD") || ci.match("првет") {
+		t.Error("case-insensitive automaton mismatch")
+	}
+}
+
+// TestMatchOptions проверяет несколько шаблонов, -w и -x для -F и регулярных выражений
+func TestMatchOptions(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		opts     matchOptions
+		line     string
+		want     [][]int
+	}{
+		{[]string{"foo"}, matchOptions{word: true}, "foo foobar foo", [][]int{{0, 3}, {11, 14}}},
+		{[]string{"foo"}, matchOptions{fixed: true, word: true}, "foo foobar foo", [][]int{{0, 3}, {11, 14}}},
+		{[]string{"foo"}, matchOptions{word: true}, "foo_bar", nil},
+		{[]string{"мир"}, matchOptions{word: true}, "мирный мир", [][]int{{13, 19}}},
+		{[]string{"fo", "foo"}, matchOptions{word: true}, "foo", [][]int{{0, 3}}},
+		{[]string{"a", "b"}, matchOptions{word: true}, "a b", [][]int{{0, 1}, {2, 3}}},
+		{[]string{"ab", "abc"}, matchOptions{}, "abcd", [][]int{{0, 3}}},
+		{[]string{"ab", "abc"}, matchOptions{fixed: true}, "abcd", [][]int{{0, 3}}},
+		{[]string{"x+", "y"}, matchOptions{line: true}, "xxx", [][]int{{0, 3}}},
+		{[]string{"x+", "y"}, matchOptions{line: true}, "xxxy", nil},
+		{[]string{"Bar", "baz"}, matchOptions{fixed: true, line: true, ignoreCase: true}, "BAR", [][]int{{0, 3}}},
+		{[]string{"bar"}, matchOptions{fixed: true, line: true}, "bar baz", nil},
+		{nil, matchOptions{}, "anything", nil},
+	}
+
+	for _, tt := range tests {
+		m, err := newMatcher(tt.patterns, tt.opts)
+		if err != nil {
+			t.Fatalf("newMatcher(%q): %v", tt.patterns, err)
+		}
+		got := m.findAll(tt.line)
+		if !reflect.DeepEqual(got, tt.want) && len(got)+len(tt.want) > 0 {
+			t.Errorf("newMatcher(%q, %+v).findAll(%q) = %v, want %v", tt.patterns, tt.opts, tt.line, got, tt.want)
+		}
+		if ok := m.match(tt.line); ok != (len(tt.want) > 0) {
+			t.Errorf("newMatcher(%q, %+v).match(%q) = %v", tt.patterns, tt.opts, tt.line, ok)
+		}
+	}
+
+	if _, err := newMatcher([]string{"ok", "(bad"}, matchOptions{}); err == nil {
+		t.Error("expected error for invalid regex in pattern list")
+	}
+}
+
+// lineWriter передает каждую запись в канал
+type lineWriter chan string
+
+func (w lineWriter) Write(b []byte) (int, error) {
+	w <- string(b)
+	return len(b), nil
+}
+
+// TestFilterInputStreaming проверяет, что совпадение печатается сразу,
+// не дожидаясь следующих данных или конца входа
+func TestFilterInputStreaming(t *testing.T) {
+	m, _ := newMatcher([]string{"ERROR"}, matchOptions{fixed: true})
+	r, w := io.Pipe()
+	out := make(lineWriter, 16)
+	done := make(chan error, 1)
+	go func() { done <- filterInput(r, "log", newPrinter(out, false, m), m) }()
+
+	if _, err := io.WriteString(w, "INFO start\nERROR one\n"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-out:
+		if got != "ERROR one\n" {
+			t.Errorf("first output = %q, want %q", got, "ERROR one\n")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("first match was not printed before the writer closed")
+	}
+
+	w.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// generateLog создает n строк журнала, примерно каждая сотая - с ошибкой
+func generateLog(n int) string {
+	var sb strings.Builder
+	for i := range n {
+		level := "INFO"
+		if i%100 == 0 {
+			level = "ERROR"
+		}
+		fmt.Fprintf(&sb, "2024-01-01T12:00:%02d %s request id=%d path=/api/v1/items/%d took=%dms\n",
+			i%60, level, i, i%1000, i%250)
+	}
+	return sb.String()
+}
+
+// recompileMatcher компилирует регулярное выражение на каждой строке,
+// как это делалось до появления matcher; используется для сравнения в бенчмарках
+type recompileMatcher struct {
+	pattern string
+}
+
+func (m recompileMatcher) compile() *regexp.Regexp {
+	re, err := regexp.Compile(m.pattern)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
+func (m recompileMatcher) match(line string) bool {
+	return m.compile().MatchString(line)
+}
+
+func (m recompileMatcher) findAll(line string) [][]int {
+	return nonEmpty(m.compile().FindAllStringIndex(line, -1))
+}
+
+// benchmarkFilter прогоняет filterInput по журналу из 100000 строк
+func benchmarkFilter(b *testing.B, m matcher) {
+	input := generateLog(100000)
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for range b.N {
+		if err := filterInput(strings.NewReader(input), "log", newPrinter(io.Discard, false, m), m); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFilterFixed(b *testing.B) {
+	m, _ := newMatcher([]string{"ERROR"}, matchOptions{fixed: true})
+	benchmarkFilter(b, m)
+}
+
+func BenchmarkFilterFixedIgnoreCase(b *testing.B) {
+	m, _ := newMatcher([]string{"error"}, matchOptions{fixed: true, ignoreCase: true})
+	benchmarkFilter(b, m)
+}
+
+func BenchmarkFilterRegex(b *testing.B) {
+	m, _ := newMatcher([]string{`ERROR .* took=1[0-9]{2}ms`}, matchOptions{})
+	benchmarkFilter(b, m)
+}
+
+func BenchmarkFilterRegexIgnoreCase(b *testing.B) {
+	m, _ := newMatcher([]string{`error .* took=1[0-9]{2}ms`}, matchOptions{ignoreCase: true})
+	benchmarkFilter(b, m)
+}
+
+func BenchmarkFilterRegexRecompile(b *testing.B) {
+	benchmarkFilter(b, recompileMatcher{pattern: `ERROR .* took=1[0-9]{2}ms`})
+}
+
+// containsMatcher проверяет шаблоны по очереди через strings.Contains;
+// используется для сравнения с автоматом Ахо–Корасик в бенчмарках
+type containsMatcher struct {
+	patterns []string
+}
+
+func (m containsMatcher) match(line string) bool {
+	for _, p := range m.patterns {
+		if strings.Contains(line, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m containsMatcher) findAll(line string) [][]int {
+	return nil
+}
+
+// blocklist создает n фиксированных строк, часть из которых встречается в журнале
+func blocklist(n int) []string {
+	patterns := make([]string, n)
+	for i := range patterns {
+		patterns[i] = fmt.Sprintf("path=/api/v1/items/%d took=%dms", i*7, i%250)
+	}
+	return patterns
+}
+
+func BenchmarkFilterFixedList(b *testing.B) {
+	m, _ := newMatcher(blocklist(5000), matchOptions{fixed: true})
+	benchmarkFilter(b, m)
+}
+
+func BenchmarkFilterFixedListContains(b *testing.B) {
+	benchmarkFilter(b, containsMatcher{patterns: blocklist(5000)})
+}
+
+// generateTree создает в dir дерево из n журналов по lines строк в 10 подкаталогах
+func generateTree(tb testing.TB, dir string, n, lines int) {
+	tb.Helper()
+	log := generateLog(lines)
+	for i := range n {
+		sub := filepath.Join(dir, fmt.Sprintf("d%02d", i%10))
+		if err := os.MkdirAll(sub, 0o755); err != nil {
+			tb.Fatal(err)
+		}
+		name := filepath.Join(sub, fmt.Sprintf("f%04d.log", i))
+		// сдвиг строк, чтобы совпадения в файлах различались
+		if err := os.WriteFile(name, []byte(log[i%len(log)/2:]), 0o644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+// setFlag временно меняет значение флага на время теста
+func setFlag[T any](tb testing.TB, p *T, v T) {
+	old := *p
+	*p = v
+	tb.Cleanup(func() { *p = old })
+}
+
+// TestSearchParallel проверяет, что параллельный поиск печатает то же, что и последовательный
+func TestSearchParallel(t *testing.T) {
+	dir := t.TempDir()
+	generateTree(t, dir, 200, 300)
+	setFlag(t, recursive, true)
+	setFlag(t, lineNumber, true)
+
+	m, _ := newMatcher([]string{"ERROR"}, matchOptions{fixed: true})
+	for _, before := range []int{0, 2} {
+		setFlag(t, beforeContext, before)
+		var seq, par strings.Builder
+		search(&seq, []string{dir}, fileFilter{}, true, m, 1)
+		search(&par, []string{dir}, fileFilter{}, true, m, 8)
+		if seq.Len() == 0 {
+			t.Fatal("no matches found")
+		}
+		if seq.String() != par.String() {
+			t.Errorf("-B %d: parallel output differs from sequential", before)
+		}
+	}
+}
+
+// benchmarkSearchTree ищет по дереву из 5000 файлов в workers горутинах
+func benchmarkSearchTree(b *testing.B, workers int) {
+	dir := b.TempDir()
+	generateTree(b, dir, 5000, 200)
+	setFlag(b, recursive, true)
+	m, _ := newMatcher([]string{`ERROR .* took=1[0-9]{2}ms`}, matchOptions{})
+
+	b.ResetTimer()
+	for range b.N {
+		search(io.Discard, []string{dir}, fileFilter{}, true, m, workers)
+	}
+}
+
+func BenchmarkSearchTreeSequential(b *testing.B) {
+	benchmarkSearchTree(b, 1)
+}
+
+func BenchmarkSearchTreeParallel(b *testing.B) {
+	benchmarkSearchTree(b, max(runtime.NumCPU(), 4))
+}
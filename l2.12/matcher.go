@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// matcher проверяет, содержит ли строка шаблон
+type matcher interface {
+	match(line string) bool
+	// findAll возвращает байтовые границы [начало, конец) непересекающихся
+	// непустых совпадений в строке слева направо (для -o)
+	findAll(line string) [][]int
+}
+
+// matchOptions - как строки сравниваются с шаблонами
+type matchOptions struct {
+	fixed      bool // -F: шаблоны - фиксированные строки
+	ignoreCase bool // -i
+	word       bool // -w: совпадение - целое слово
+	line       bool // -x: совпадение - вся строка, важнее word
+}
+
+// newMatcher создает matcher для списка шаблонов: строка подходит, если подходит
+// хотя бы под один. Шаблоны - фиксированные строки (-F) или регулярные выражения,
+// которые проверяются и компилируются один раз здесь. Несколько фиксированных строк
+// ищутся автоматом Ахо–Корасик. Без шаблонов (пустой файл -f) не подходит ни одна строка.
+func newMatcher(patterns []string, opts matchOptions) (matcher, error) {
+	switch {
+	case len(patterns) == 0:
+		return acMatcher{ac: newAhoCorasick(nil, false)}, nil
+	case opts.fixed && opts.line:
+		return newLineSetMatcher(patterns, opts.ignoreCase), nil
+	case opts.fixed && (opts.word || len(patterns) > 1):
+		return acMatcher{ac: newAhoCorasick(patterns, opts.ignoreCase), word: opts.word}, nil
+	case opts.fixed && opts.ignoreCase:
+		return foldMatcher{
+			pattern: strings.ToLower(patterns[0]),
+			re:      regexp.MustCompile("(?i)" + regexp.QuoteMeta(patterns[0])),
+		}, nil
+	case opts.fixed:
+		return fixedMatcher{pattern: patterns[0]}, nil
+	}
+
+	// Каждый шаблон проверяется отдельно, чтобы ошибка указывала на него,
+	// а не на общее выражение
+	alternatives := make([]string, len(patterns))
+	for i, p := range patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return nil, fmt.Errorf("invalid regex pattern: %w", err)
+		}
+		alternatives[i] = "(?:" + p + ")"
+	}
+	expr := strings.Join(alternatives, "|")
+
+	flags := ""
+	if opts.ignoreCase {
+		flags = "(?i)"
+	}
+	switch {
+	case opts.line:
+		expr = flags + "^(?:" + expr + ")$"
+	case opts.word:
+		// Символ перед словом входит в выражение, поэтому поиск идет в "\n"+line
+		// (см. wordRegexMatcher): так слово может начинаться и с начала строки
+		expr = flags + "(?m)" + nonWord + "(" + expr + ")(?:" + nonWord + "|$)"
+	default:
+		expr = flags + expr
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex pattern: %w", err)
+	}
+	// Из совпадений с одного места grep выбирает самое длинное
+	re.Longest()
+	if opts.word && !opts.line {
+		return wordRegexMatcher{re: re}, nil
+	}
+	return regexMatcher{re: re}, nil
+}
+
+// fixedMatcher ищет фиксированную строку
+type fixedMatcher struct {
+	pattern string
+}
+
+func (m fixedMatcher) match(line string) bool {
+	return strings.Contains(line, m.pattern)
+}
+
+func (m fixedMatcher) findAll(line string) [][]int {
+	if m.pattern == "" {
+		return nil
+	}
+	var spans [][]int
+	for start := 0; ; {
+		i := strings.Index(line[start:], m.pattern)
+		if i < 0 {
+			return spans
+		}
+		start += i
+		spans = append(spans, []int{start, start + len(m.pattern)})
+		start += len(m.pattern)
+	}
+}
+
+// foldMatcher ищет фиксированную строку без учета регистра, pattern уже в нижнем регистре.
+// Границы совпадений ищутся через re: после ToLower они могут сместиться.
+type foldMatcher struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+func (m foldMatcher) match(line string) bool {
+	return strings.Contains(strings.ToLower(line), m.pattern)
+}
+
+func (m foldMatcher) findAll(line string) [][]int {
+	return nonEmpty(m.re.FindAllStringIndex(line, -1))
+}
+
+// regexMatcher ищет совпадение с заранее скомпилированным регулярным выражением
+type regexMatcher struct {
+	re *regexp.Regexp
+}
+
+func (m regexMatcher) match(line string) bool {
+	return m.re.MatchString(line)
+}
+
+func (m regexMatcher) findAll(line string) [][]int {
+	return nonEmpty(m.re.FindAllStringIndex(line, -1))
+}
+
+// nonWord - символ, который не может быть частью слова для -w
+const nonWord = `[^\pL\pN_]`
+
+// isWordRune проверяет, может ли руна быть частью слова для -w: буквы, цифры и '_'
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// wordBounded проверяет, что до и после line[start:end] нет символов слова
+func wordBounded(line string, start, end int) bool {
+	if r, _ := utf8.DecodeLastRuneInString(line[:start]); start > 0 && isWordRune(r) {
+		return false
+	}
+	if r, _ := utf8.DecodeRuneInString(line[end:]); end < len(line) && isWordRune(r) {
+		return false
+	}
+	return true
+}
+
+// wordRegexMatcher ищет совпадения регулярного выражения, которые являются целыми словами (-w).
+// re ищет в "\n"+line символ перед словом, само слово в группе 1 и символ после него.
+type wordRegexMatcher struct {
+	re *regexp.Regexp
+}
+
+func (m wordRegexMatcher) match(line string) bool {
+	return m.re.MatchString("\n" + line)
+}
+
+func (m wordRegexMatcher) findAll(line string) [][]int {
+	text := "\n" + line
+	var spans [][]int
+	for pos := 0; pos < len(text); {
+		loc := m.re.FindStringSubmatchIndex(text[pos:])
+		if loc == nil {
+			break
+		}
+		start, end := pos+loc[2], pos+loc[3]
+		if end == start {
+			pos = end
+			continue
+		}
+		spans = append(spans, []int{start - 1, end - 1})
+		// Последний символ слова - граница слева для следующего поиска
+		_, size := utf8.DecodeLastRuneInString(text[:end])
+		pos = end - size
+	}
+	return spans
+}
+
+// acMatcher ищет фиксированные строки автоматом Ахо–Корасик, с word - только целые слова
+type acMatcher struct {
+	ac   *ahoCorasick
+	word bool
+}
+
+func (m acMatcher) match(line string) bool {
+	if !m.word {
+		return m.ac.match(line)
+	}
+	_, _, ok := m.ac.find(line, 0, m.accept(line))
+	return ok
+}
+
+func (m acMatcher) findAll(line string) [][]int {
+	accept := m.accept(line)
+	var spans [][]int
+	for pos := 0; pos < len(line); {
+		start, end, ok := m.ac.find(line, pos, accept)
+		if !ok {
+			break
+		}
+		spans = append(spans, []int{start, end})
+		pos = end
+	}
+	return spans
+}
+
+// accept возвращает проверку границ слова для find, без -w - nil
+func (m acMatcher) accept(line string) func(start, end int) bool {
+	if !m.word {
+		return nil
+	}
+	return func(start, end int) bool { return wordBounded(line, start, end) }
+}
+
+// lineSetMatcher сравнивает строку целиком с набором фиксированных строк (-F -x),
+// с ignoreCase ключи набора в нижнем регистре
+type lineSetMatcher struct {
+	lines      map[string]struct{}
+	ignoreCase bool
+}
+
+func newLineSetMatcher(patterns []string, ignoreCase bool) lineSetMatcher {
+	m := lineSetMatcher{lines: make(map[string]struct{}, len(patterns)), ignoreCase: ignoreCase}
+	for _, p := range patterns {
+		if ignoreCase {
+			p = strings.ToLower(p)
+		}
+		m.lines[p] = struct{}{}
+	}
+	return m
+}
+
+func (m lineSetMatcher) match(line string) bool {
+	if m.ignoreCase {
+		line = strings.ToLower(line)
+	}
+	_, ok := m.lines[line]
+	return ok
+}
+
+func (m lineSetMatcher) findAll(line string) [][]int {
+	if line == "" || !m.match(line) {
+		return nil
+	}
+	return [][]int{{0, len(line)}}
+}
+
+// nonEmpty убирает пустые совпадения: grep -o их не печатает
+func nonEmpty(spans [][]int) [][]int {
+	n := 0
+	for _, s := range spans {
+		if s[1] > s[0] {
+			spans[n] = s
+			n++
+		}
+	}
+	return spans[:n]
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// fileResult - результат поиска в одном файле: накопленный вывод или ошибка
+type fileResult struct {
+	path string
+	out  bytes.Buffer
+	p    *printer // nil для ошибок обхода каталогов
+	err  error
+	done chan struct{} // закрывается, когда результат готов
+}
+
+// searchParallel ищет совпадения в файлах files в workers горутинах.
+// Вывод каждого файла копится в буфере и печатается в w в порядке аргументов
+// и обхода каталогов, так что результат не отличается от последовательного поиска.
+// В памяти одновременно не больше 4*workers результатов.
+func searchParallel(w io.Writer, files []string, filter fileFilter, showName bool, m matcher, workers int) {
+	work := make(chan *fileResult)
+	order := make(chan *fileResult, 4*workers)
+
+	for range workers {
+		go func() {
+			for r := range work {
+				r.p = newPrinter(&r.out, showName, m)
+				if !*quiet || !selected.Load() {
+					r.err = searchFile(r.path, r.p, m)
+				}
+				close(r.done)
+			}
+		}()
+	}
+
+	// Обход каталогов идет одновременно с поиском, порядок вывода задает order
+	go func() {
+		defer close(order)
+		defer close(work)
+		for _, name := range files {
+			eachFile(name, filter, func(path string) {
+				r := &fileResult{path: path, done: make(chan struct{})}
+				order <- r
+				work <- r
+			}, func(err error) {
+				r := &fileResult{err: err, done: make(chan struct{})}
+				close(r.done)
+				order <- r
+			})
+		}
+	}()
+
+	printedAny := false
+	for r := range order {
+		<-r.done
+		if r.p != nil && r.p.printedAny {
+			// Разделитель между группами строк разных файлов, как при последовательном выводе
+			if r.p.hasContext && printedAny {
+				colors.paint(w, colors.separator, Divider)
+				fmt.Fprintln(w)
+			}
+			printedAny = true
+		}
+		w.Write(r.out.Bytes())
+		if r.err != nil {
+			reportError(r.err)
+		}
+	}
+}
@@ -2,7 +2,7 @@
 set -Eeuo pipefail
 
 # Сборка бинаря
-go build -o mygrep main.go
+go build -o mygrep .
 
 # Массив тестов: "<name>|<pattern>|<file>|<flags>
 TESTS=(
@@ -46,6 +46,46 @@ TESTS=(
 "duplicates_case_sensitive|Cherry|testcases/test3.txt"
 "duplicates_elderberry|Elderberry|testcases/test3.txt"
 "duplicates_date|date|testcases/test3.txt|-i"
+
+# Тесты с каталогами
+"recursive|test|testcases|-r"
+"recursive_include|test|testcases|-r --include=test1*"
+"recursive_exclude|test|testcases|-r --exclude=test1* -n"
+"recursive_no_filename|test|testcases|-r -h"
+"recursive_parallel|test|testcases|-r -n -A 1|-r -n -A 1 -j 4"
+"error_directory|test|testcases"
+
+# Тесты с -o, -b, -l/-L, -m и -q
+"only_matching|error [0-9]+|testcases/test2.txt|-o -n -E"
+"only_matching_ignore_case|cherry|testcases/test3.txt|-o -i -b"
+"only_matching_context|test|testcases/test1.txt|-o -i -C 1"
+"byte_offset|test|testcases/test1.txt|-b -n"
+"files_with_matches|test|testcases|-r -l"
+"files_without_match|Cherry|testcases|-r -L --exclude=empty.txt --exclude=patterns.txt"
+"max_count|cherry|testcases/test3.txt|-m 2 -n"
+"max_count_context|cherry|testcases/test3.txt|-i -m 1 -A 2"
+"max_count_count|cherry|testcases/test3.txt|-c -m 1"
+"quiet|test|testcases/test1.txt|-q"
+"error_quiet_no_match|nonexistent|testcases/test1.txt|-q"
+
+# Тесты с подсветкой
+"color_always|test|testcases/test1.txt|--color=always -i -n"
+"color_context|cherry|testcases|--color=always -r -C 1 -b"
+"color_invert|test|testcases/test1.txt|--color=always -v -A 1"
+"color_only_matching|error [0-9]+|testcases/test2.txt|--color=always -o -n -E"
+"color_count|test|testcases|--color=always -r -c --exclude=empty.txt --exclude=patterns.txt"
+"color_auto_pipe|test|testcases/test1.txt|--color=auto"
+
+# Тесты с несколькими шаблонами, -w и -x
+"multiple_patterns|error|testcases/test2.txt|-e info -e"
+"multiple_patterns_only_matching|rr|testcases/test3.txt|-o -e berry -e"
+"pattern_file|testcases/patterns.txt|testcases/test2.txt|-n -f"
+"pattern_file_fixed|testcases/patterns.txt|testcases/test3.txt|-F -i -f"
+"word_regexp|test|testcases/test1.txt|-w -i"
+"word_regexp_fixed|date|testcases/test3.txt|-w -F -i -o"
+"word_regexp_partial|berry|testcases/test3.txt|-w"
+"line_regexp|cherry|testcases/test3.txt|-x -i"
+"line_regexp_fixed|date|testcases/test3.txt|-x -F -e DaTe -e"
 )
 
 ok=0